@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+)
+
+// ANSI color codes used in scan output
+const (
+	colorRed    = "31"
+	colorYellow = "33"
+	colorGreen  = "32"
+)
+
+// useColor is false when stdout is not a terminal or NO_COLOR is set
+// (https://no-color.org)
+var useColor = colorSupported()
+
+// colorSupported reports whether stdout is a terminal that should get color
+func colorSupported() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the given ANSI color when color output is enabled
+func colorize(color, s string) string {
+	if !useColor {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+// red marks blocked files and errors
+func red(s string) string { return colorize(colorRed, s) }
+
+// yellow marks skipped files and warnings
+func yellow(s string) string { return colorize(colorYellow, s) }
+
+// green marks clean results
+func green(s string) string { return colorize(colorGreen, s) }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"dlp-test/scanner"
+)
+
+// diagnose explains a DLP error in terms of what to fix
+func diagnose(err error, projectID string) string {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		return "the credentials were rejected; check the service account key or run `gcloud auth application-default login`"
+	case codes.PermissionDenied:
+		return fmt.Sprintf("the credentials lack permission; grant roles/dlp.user on project %s and make sure the DLP API is enabled", projectID)
+	case codes.NotFound:
+		return fmt.Sprintf("project %s was not found; check projectId in the config", projectID)
+	case codes.ResourceExhausted:
+		return "the DLP quota for the project is exhausted"
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return "the DLP API could not be reached; check network access to dlp.googleapis.com"
+	}
+	return "unexpected error"
+}
+
+// runDoctor checks that the hook can load its config, authenticate to DLP and
+// inspect content, printing the result of each step
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	credentialsFile := fs.String("credentials", os.Getenv(credentialsEnvVar), "path to a service account JSON key file (defaults to $"+credentialsEnvVar+")")
+	configFile := fs.String("config", "", "path to a JSON scan config (defaults to "+scanner.DefaultConfigFile+" when present)")
+	fs.Parse(args)
+
+	configPath := *configFile
+	if configPath == "" {
+		configPath = scanner.DefaultConfigFile
+	}
+	cfg, err := scanner.LoadConfig(configPath, *configFile != "")
+	if err != nil {
+		fmt.Printf("[FAIL] config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[ok]   config: parent %s\n", cfg.ParentPath())
+
+	if *credentialsFile != "" {
+		fmt.Printf("[ok]   credentials: key file %s\n", *credentialsFile)
+	} else {
+		fmt.Println("[ok]   credentials: application default credentials")
+	}
+
+	ctx := context.Background()
+	clientOpts := scanner.DefaultClientOptions()
+	clientOpts.CredentialsFile = *credentialsFile
+	client, err := scanner.NewClient(ctx, clientOpts)
+	if err != nil {
+		fmt.Printf("[FAIL] client: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+	fmt.Println("[ok]   client created")
+
+	if err := scanner.New(client, cfg).SelfTest(ctx); err != nil {
+		fmt.Printf("[FAIL] inspect: %v\n", err)
+		fmt.Printf("       %s\n", diagnose(err, cfg.ProjectID))
+		os.Exit(1)
+	}
+	fmt.Println("[ok]   inspect: synthetic email address detected")
+	fmt.Println("DLP connectivity and permissions look good.")
+}
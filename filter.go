@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"dlp-test/scanner"
+)
+
+// runFilterScan runs as a git clean filter for the file path, configured
+// with e.g.
+//
+//	git config filter.dlp.clean "dlp-test -filter %f"
+//	git config filter.dlp.required true
+//	echo "* filter=dlp" >> .gitattributes
+//
+// The content being staged is read from standard input, scanned as path, and
+// written to out unchanged. Messages go to standard error, since out is what
+// git stages. When the findings block it exits non-zero, after writing the
+// content only under scanner.FilterPass; git then fails the staging when the
+// filter is required and otherwise stages the content unfiltered.
+func runFilterScan(ctx context.Context, s *scanner.Scanner, opts options, path string, out io.Writer) {
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s from git: %v\n", path, err)
+		os.Exit(1)
+	}
+	cfg := s.Config()
+	result, err := s.ScanReader(ctx, path, bytes.NewReader(data))
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		if cfg.FailurePolicy == scanner.FailOpen && scanner.IsConnectivityError(err) {
+			stageUnscanned(out, bytes.NewReader(data), path, err)
+			return
+		}
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, cfg, "filter", result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	if blocks(cfg, result) {
+		for _, f := range result.Files {
+			for _, finding := range f.Findings {
+				if printableFinding() {
+					fmt.Printf("  %s (%s)\n", describeFinding(f.Path, finding), finding.Likelihood)
+				}
+			}
+		}
+		printOmittedFindings(os.Stdout)
+		fmt.Println(red(fmt.Sprintf("Sensitive data detected in %s as it was staged.", path)))
+		if cfg.FilterFindings == scanner.FilterPass {
+			writeFiltered(out, path, data)
+		}
+		os.Exit(1)
+	}
+	exitOnErrors(s, result)
+	writeFiltered(out, path, data)
+}
+
+// stageUnscanned hands the content read from in back to git without a scan
+// after DLP turned out to be unreachable under the fail-open policy
+func stageUnscanned(out io.Writer, in io.Reader, path string, err error) {
+	fmt.Println(yellow(fmt.Sprintf("WARNING: DLP API is unreachable (%v).", err)))
+	fmt.Println(yellow(fmt.Sprintf("WARNING: failure policy is fail-open; staging %s WITHOUT a DLP scan.", path)))
+	if _, err := io.Copy(out, in); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s back to git: %v\n", path, err)
+		os.Exit(1)
+	}
+}
+
+// writeFiltered hands content back to git, exiting non-zero if it cannot
+func writeFiltered(out io.Writer, path string, data []byte) {
+	if _, err := out.Write(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s back to git: %v\n", path, err)
+		os.Exit(1)
+	}
+}
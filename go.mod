@@ -4,6 +4,7 @@ go 1.22.2
 
 require (
     cloud.google.com/go/dlp v1.18.0
+    github.com/googleapis/gax-go/v2 v2.13.0
     google.golang.org/api v0.197.0
     google.golang.org/genproto v0.0.0-20240903143218-8af14fe29dc1
     google.golang.org/grpc v1.66.2
@@ -19,7 +20,6 @@ require (
     github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
     github.com/google/s2a-go v0.1.8 // indirect
     github.com/googleapis/enterprise-certificate-proxy v0.3.4 // indirect
-    github.com/googleapis/gax-go/v2 v2.13.0 // indirect
     go.opencensus.io v0.24.0 // indirect
     go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.55.0 // indirect
     go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.55.0 // indirect
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+	"dlp-test/scanner"
+)
+
+// describeCategories formats the categories DLP assigns an info type, such as
+// "location GLOBAL, type PII"
+func describeCategories(categories []*dlppb.InfoTypeCategory) string {
+	var parts []string
+	for _, c := range categories {
+		switch {
+		case c.GetLocationCategory() != 0:
+			parts = append(parts, "location "+c.GetLocationCategory().String())
+		case c.GetIndustryCategory() != 0:
+			parts = append(parts, "industry "+c.GetIndustryCategory().String())
+		case c.GetTypeCategory() != 0:
+			parts = append(parts, "type "+c.GetTypeCategory().String())
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runInfoTypes prints the built-in info types DLP supports, sorted by name,
+// for authoring the infoTypes and pathRules of a config
+func runInfoTypes(args []string) {
+	fs := flag.NewFlagSet("info-types", flag.ExitOnError)
+	credentialsFile := fs.String("credentials", os.Getenv(credentialsEnvVar), "path to a service account JSON key file (defaults to $"+credentialsEnvVar+")")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	clientOpts := scanner.DefaultClientOptions()
+	clientOpts.CredentialsFile = *credentialsFile
+	client, err := scanner.NewClient(ctx, clientOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating DLP client: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	known, err := scanner.ListInfoTypes(ctx, client)
+	if err != nil {
+		printScanError(err)
+		os.Exit(1)
+	}
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		desc := known[name]
+		fmt.Println(name)
+		if desc.GetDescription() != "" {
+			fmt.Printf("  %s\n", desc.GetDescription())
+		}
+		var supported []string
+		for _, s := range desc.GetSupportedBy() {
+			supported = append(supported, s.String())
+		}
+		if len(supported) > 0 {
+			fmt.Printf("  supported by: %s\n", strings.Join(supported, ", "))
+		}
+		if categories := describeCategories(desc.GetCategories()); categories != "" {
+			fmt.Printf("  categories: %s\n", categories)
+		}
+	}
+}
@@ -2,145 +2,1225 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	dlp "cloud.google.com/go/dlp/apiv2"
-	dlppb "google.golang.org/genproto/googleapis/privacy/dlp/v2"
+	"dlp-test/scanner"
 )
 
-// GetChangedFiles retrieves the list of files changed in the latest commit
-func GetChangedFiles() ([]string, error) {
-	cmd := exec.Command("git", "diff", "--name-only", "HEAD~1", "HEAD")
-	output, err := cmd.Output()
+// credentialsEnvVar names the environment variable that can point at a service account key file
+const credentialsEnvVar = "DLP_CREDENTIALS_FILE"
+
+// attestationKeyEnvVar names the environment variable that can point at the attestation signing key
+const attestationKeyEnvVar = "DLP_ATTESTATION_KEY_FILE"
+
+// scanHeader returns the extra HTTP header sent with a scanned push: a signed
+// attestation for HEAD when a key is configured, a plain marker otherwise
+func scanHeader(opts options) (string, error) {
+	if opts.attestationKeyFile == "" {
+		return "DLP-Scanned: true", nil
+	}
+	key, err := scanner.LoadAttestationKey(opts.attestationKeyFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get changed files: %v", err)
+		return "", err
 	}
-	files := strings.Split(strings.TrimSpace(string(output)), "\n")
-	return files, nil
+	head, err := scanner.GetHeadCommit()
+	if err != nil {
+		return "", err
+	}
+	return scanner.AttestationHeader + ": " + scanner.SignAttestation(key, head, time.Now()), nil
 }
 
-// DLPScan scans a given text for sensitive data using Google Cloud DLP
-func DLPScan(projectID, text string) (bool, error) {
-	ctx := context.Background()
-	client, err := dlp.NewClient(ctx)
+// writeAttestation writes the attestation for a scan of the commits in
+// from..HEAD to the -attestation-out path, when set, signed with the
+// attestation key when one is configured
+func writeAttestation(opts options, cfg *scanner.Config, from string, commits []string, result *scanner.Result) {
+	if opts.attestationOut == "" {
+		return
+	}
+	head, err := scanner.GetHeadCommit()
 	if err != nil {
-		return false, fmt.Errorf("failed to create DLP client: %v", err)
+		fmt.Fprintf(os.Stderr, "Error creating scan attestation: %v\n", err)
+		os.Exit(1)
 	}
-	defer client.Close()
+	passed := !result.Blocks(cfg.FailOn) && len(result.Errors) == 0 &&
+		!(cfg.Strict && len(result.Warnings)+len(result.Unscanned()) > 0)
+	attestation := scanner.NewAttestation(cfg, from, head, commits, passed)
+	if opts.attestationKeyFile != "" {
+		key, err := scanner.LoadAttestationKey(opts.attestationKeyFile)
+		if err == nil {
+			err = attestation.Sign(key)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error signing scan attestation: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := attestation.WriteFile(opts.attestationOut); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing scan attestation: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	customRegexPattern := "XY[0-9]{4}.*"
-	customInfoType := &dlppb.CustomInfoType{
-		InfoType: &dlppb.InfoType{Name: "RampID"},
-		Type: &dlppb.CustomInfoType_Regex_{Regex: &dlppb.CustomInfoType_Regex{
-			Pattern: customRegexPattern,
-		}},
-		Likelihood: dlppb.Likelihood_POSSIBLE,
+// gitConfigEnv returns environment entries that add key=value to the git
+// configuration of a child process, keeping any GIT_CONFIG_* entries already set
+func gitConfigEnv(env []string, key, value string) []string {
+	count := 0
+	if n, err := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT")); err == nil && n > 0 {
+		count = n
 	}
+	return append(env,
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, value),
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", count+1),
+	)
+}
 
-	inspectConfig := &dlppb.InspectConfig{
-		InfoTypes: []*dlppb.InfoType{
-			{Name: "EMAIL_ADDRESS"},
-			{Name: "PHONE_NUMBER"},
-			{Name: "US_SOCIAL_SECURITY_NUMBER"},
-		},
-		CustomInfoTypes: []*dlppb.CustomInfoType{customInfoType},
-		IncludeQuote:    true,
+// RunGitPush performs the git push command. A non-empty header is sent with
+// the push's HTTP requests through git's http.extraHeader setting. It is
+// scoped to this child process and passed through the environment rather
+// than -c so it does not show up in the process list. A hook process cannot
+// change the request of the git that started it, which is why this tool runs
+// the push itself. A quiet push only prints errors; a forced one replaces
+// the remote branch with --force-with-lease, so it fails rather than drop
+// commits pushed since the last fetch.
+func RunGitPush(header string, opts options) error {
+	args := []string{"push"}
+	if opts.quiet {
+		args = append(args, "--quiet")
+	}
+	if opts.forcePush {
+		args = append(args, "--force-with-lease")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if header != "" {
+		cmd.Env = gitConfigEnv(os.Environ(), "http.extraHeader", header)
 	}
 
-	contentItem := &dlppb.ContentItem{
-		DataItem: &dlppb.ContentItem_Value{Value: text},
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git push failed: %v", err)
 	}
+	return nil
+}
 
-	req := &dlppb.InspectContentRequest{
-		Parent:        fmt.Sprintf("projects/%s/locations/global", projectID),
-		Item:          contentItem,
-		InspectConfig: inspectConfig,
+// describeFinding formats a finding as "path:line:col: INFO_TYPE", the form
+// editors jump to, noting the field for JSON and YAML values
+func describeFinding(path string, finding scanner.Finding) string {
+	location := path
+	if finding.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", path, finding.Line, finding.Column)
+	}
+	description := fmt.Sprintf("%s: %s", location, finding.InfoType)
+	if finding.InPath {
+		description += " in the file path"
+	}
+	if finding.Context {
+		description += " on a line the change did not add"
+	}
+	if finding.Region == scanner.RegionComment {
+		description += " in a comment"
+	}
+	if finding.Quote != "" {
+		description += fmt.Sprintf(" %q", finding.Quote)
 	}
+	for _, box := range finding.BoundingBoxes {
+		description += fmt.Sprintf(" at %dx%d+%d+%d", box.Width, box.Height, box.Left, box.Top)
+	}
+	if finding.Field != "" {
+		description += " in field " + finding.Field
+	}
+	if finding.Template != "" {
+		description += " (template " + finding.Template + ")"
+	}
+	if finding.Informational {
+		description += " (informational, below likelihood threshold)"
+	} else if finding.Action == scanner.ActionWarn {
+		description += " (warning only)"
+	}
+	return description
+}
 
-	resp, err := client.InspectContent(ctx, req)
-	if err != nil {
-		return false, fmt.Errorf("failed to inspect content: %v", err)
+// redactWorkingTree applies the redact action: findings in the final state
+// of pushed files whose action is scanner.ActionRedact are redacted in the
+// working tree. The commits still hold the data, so the push is blocked
+// regardless and only needs the change amended in. The redacted content is
+// inspected again and any redact findings left in it are reported.
+func redactWorkingTree(ctx context.Context, s *scanner.Scanner, result *scanner.Result) {
+	for _, f := range result.Files {
+		if f.Commit != "" {
+			continue
+		}
+		var redact []scanner.Finding
+		for _, finding := range f.Findings {
+			if finding.Action == scanner.ActionRedact {
+				redact = append(redact, finding)
+			}
+		}
+		if len(redact) == 0 {
+			continue
+		}
+		info, err := os.Stat(f.Path)
+		var data, redacted []byte
+		if err == nil {
+			data, err = ioutil.ReadFile(f.Path)
+		}
+		if err == nil {
+			redacted = scanner.Redact(data, redact, s.Config().Masking)
+			err = ioutil.WriteFile(f.Path, redacted, info.Mode().Perm())
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red(fmt.Sprintf("Could not redact %s: %v", f.Path, err)))
+			continue
+		}
+		fmt.Println(yellow(fmt.Sprintf("Redacted %d finding(s) in %s; amend the commit before pushing again.", len(redact), f.Path)))
+
+		remaining, err := s.VerifyRedaction(ctx, f.Path, redacted)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red(fmt.Sprintf("Could not verify the redaction of %s: %v", f.Path, err)))
+			continue
+		}
+		for _, finding := range remaining {
+			if finding.Action == scanner.ActionRedact {
+				fmt.Println(red(fmt.Sprintf("  still present after redaction: %s", describeFinding(f.Path, finding))))
+			}
+		}
 	}
+}
 
-	// If any findings are present, return true for sensitive data found
-	return len(resp.Result.Findings) > 0, nil
+// blockGitOperation reports which files and info types blocked the push and
+// exits with a non-zero status
+func blockGitOperation(result *scanner.Result) {
+	fmt.Println(red("Sensitive data detected. Blocking git push."))
+	// Group by commit, so it is clear which commit to fix
+	grouped := make(map[string]bool)
+	for _, c := range result.Commits {
+		grouped[c.SHA] = true
+		flagged := (&scanner.Result{Files: result.FilesInCommit(c.SHA)}).Flagged()
+		if len(flagged) == 0 {
+			continue
+		}
+		fmt.Printf("  commit %.8s %s\n", c.SHA, c.Subject)
+		printFlaggedFiles("    ", flagged, false)
+	}
+	var rest []scanner.FileResult
+	for _, f := range result.Flagged() {
+		if !grouped[f.Commit] {
+			rest = append(rest, f)
+		}
+	}
+	if len(rest) > 0 {
+		fmt.Println("  final state and refs")
+		printFlaggedFiles("    ", rest, true)
+	}
+	printOmittedFindings(os.Stdout)
+	os.Exit(1)
 }
 
-// SetGitExtraHeader sets the GIT_HTTP_EXTRAHEADER environment variable
-func SetGitExtraHeader() {
-	os.Setenv("GIT_HTTP_EXTRAHEADER", "DLP-Scanned: true")
-	fmt.Println("Set GIT_HTTP_EXTRAHEADER environment variable.")
+// maxFindingsToPrint caps the findings printed to the console, see
+// -max-findings-to-print; 0 prints them all. Reports still hold every one.
+var maxFindingsToPrint int
+
+// findingsPrinted and findingsOmitted count findings against maxFindingsToPrint
+var findingsPrinted, findingsOmitted int
+
+// printableFinding reports whether another finding may be printed under
+// maxFindingsToPrint, counting it either way
+func printableFinding() bool {
+	if maxFindingsToPrint > 0 && findingsPrinted >= maxFindingsToPrint {
+		findingsOmitted++
+		return false
+	}
+	findingsPrinted++
+	return true
 }
 
-// ClearGitExtraHeader clears the GIT_HTTP_EXTRAHEADER environment variable
-func ClearGitExtraHeader() {
-	os.Unsetenv("GIT_HTTP_EXTRAHEADER")
-	fmt.Println("Cleared GIT_HTTP_EXTRAHEADER environment variable.")
+// printOmittedFindings prints how many findings maxFindingsToPrint left out, if any
+func printOmittedFindings(w io.Writer) {
+	if findingsOmitted > 0 {
+		fmt.Fprintf(w, "  ... and %d more finding(s); use -report-file for the full list.\n", findingsOmitted)
+	}
 }
 
-// RunGitPush performs the git push command
-func RunGitPush() error {
-	cmd := exec.Command("git", "push")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// printFlaggedFiles lists files with their info types and findings,
+// indented, naming the commit each was read from when showCommit is set
+func printFlaggedFiles(indent string, files []scanner.FileResult, showCommit bool) {
+	for _, f := range files {
+		location := f.Path
+		if showCommit && f.Commit != "" {
+			location = fmt.Sprintf("%s (commit %.8s)", f.Path, f.Commit)
+		}
+		fmt.Printf("%s%s: %s\n", indent, red(location), strings.Join(f.InfoTypes(), ", "))
+		for _, finding := range f.Findings {
+			if printableFinding() {
+				fmt.Printf("%s  %s\n", indent, describeFinding(f.Path, finding))
+			}
+		}
+	}
+}
 
-	// Run the command with the environment variable set
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git push failed: %v", err)
+// listFlag collects a flag that may be repeated or given as a comma-separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
 	}
 	return nil
 }
 
-// ScanFile reads file content, performs a DLP scan, and runs Git push with an extra header if no sensitive data is found
-func ScanFile(filename, projectID string) error {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("could not read file: %v", err)
+// options holds the command-line settings that shape output rather than scan policy
+type options struct {
+	reportFile         string
+	webhookURL         string
+	attestationKeyFile string
+	// quiet discards standard output, leaving only errors and a summary of
+	// blocked findings on standard error
+	quiet bool
+	// timings prints the time spent in each scan phase
+	timings bool
+	// forcePush pushes rewritten history with --force-with-lease
+	forcePush bool
+	// attestationOut is where to write the JSON attestation of the scan
+	attestationOut string
+	// format is formatText or formatGitHub
+	format string
+}
+
+// Output formats for -format
+const (
+	// formatText prints findings for a person at a terminal
+	formatText = "text"
+	// formatGitHub also prints them as GitHub Actions annotations
+	formatGitHub = "github"
+)
+
+// emitResult sends a scan result to every reporter the options select,
+// exiting non-zero when one of them fails
+func emitResult(opts options, cfg *scanner.Config, operation string, result *scanner.Result) {
+	if err := newReporter(opts, cfg).Report(operation, result, result.Blocks(cfg.FailOn)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
 	}
+}
 
-	// Perform DLP scan
-	foundSensitiveData, err := DLPScan(projectID, string(data))
-	if err != nil {
-		return err
+// printScanError prints a scan failure, with guidance for quota exhaustion
+func printScanError(err error) {
+	fmt.Fprintln(os.Stderr, red(fmt.Sprintf("Scan error: %v", err)))
+	if scanner.IsQuotaError(err) {
+		fmt.Fprintln(os.Stderr, "DLP quota exhausted (RESOURCE_EXHAUSTED): reduce -concurrency or request a quota increase for the project.")
 	}
+}
 
-	if !foundSensitiveData {
-		fmt.Printf("No sensitive data found in file %s. Proceeding with git push.\n", filename)
-		SetGitExtraHeader()
-		defer ClearGitExtraHeader() // Ensure the environment variable is cleared after use
-		if err := RunGitPush(); err != nil {
-			return err
+// reportResult prints the warnings, errors and flagged files of a scan result
+func reportResult(result *scanner.Result) {
+	for _, w := range result.Warnings {
+		fmt.Println(yellow("WARNING: " + w))
+	}
+	for _, e := range result.Errors {
+		fmt.Fprintln(os.Stderr, red("ERROR: "+e))
+	}
+	for _, commit := range result.Allowlisted {
+		fmt.Println(yellow(fmt.Sprintf("Skipped commit %.8s: allowlisted in the config", commit)))
+	}
+	for _, f := range result.SkippedFiles() {
+		fmt.Println(yellow(fmt.Sprintf("Skipped file %s: %s", f.Path, f.Skipped)))
+	}
+	for _, f := range result.Files {
+		if f.Sampled {
+			fmt.Println(yellow(fmt.Sprintf("Sampled file %s: too large to inspect whole (%s)", f.Path, scanner.SampledNotExhaustive)))
 		}
+		if f.Dirty {
+			fmt.Println(yellow(fmt.Sprintf("Scanned file %s from the working tree, which has uncommitted changes; set dirtyFiles to %q to scan the committed content", f.Path, scanner.DirtyCommitted)))
+		}
+	}
+	for _, f := range result.Flagged() {
+		if f.Commit != "" {
+			fmt.Println(red(fmt.Sprintf("Sensitive data found in file %s at commit %.8s (rule set: %s).", f.Path, f.Commit, f.RuleSet)))
+		} else {
+			fmt.Println(red(fmt.Sprintf("Sensitive data found in file %s (rule set: %s).", f.Path, f.RuleSet)))
+		}
+	}
+	if counts := result.CategoryCounts(); len(counts) > 0 {
+		fmt.Printf("Findings by category: %s.\n", scanner.CategorySummary(counts))
+	}
+}
+
+// reportTimings prints the time spent in each scan phase when -timings is set
+func reportTimings(opts options, s *scanner.Scanner) {
+	if !opts.timings {
+		return
+	}
+	for _, phase := range []string{scanner.PhaseGit, scanner.PhaseFetch, scanner.PhaseDLP} {
+		fmt.Printf("Time in %s: %s.\n", phase, s.Timings()[phase].Round(time.Millisecond))
+	}
+}
+
+// reportSuppressed prints how many findings each excluded info type dropped,
+// and notes when the findings cap left some out
+func reportSuppressed(s *scanner.Scanner) {
+	if truncated := s.TruncatedRequests(); truncated > 0 {
+		fmt.Println(yellow(fmt.Sprintf("Findings truncated: %d DLP request(s) hit maxFindingsPerRequest (%d); not every finding is listed.", truncated, s.Config().MaxFindingsPerRequest)))
+	}
+	for _, path := range s.TruncatedFiles() {
+		warning := fmt.Sprintf("WARNING: findings in %s may be incomplete; DLP truncated them.", path)
+		if !s.Config().RescanTruncated {
+			warning += " Set rescanTruncated to inspect it again in smaller pieces."
+		}
+		fmt.Println(yellow(warning))
+	}
+	counts := s.SuppressedCounts()
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("Suppressed %d %s finding(s) (excludeInfoTypes).\n", counts[name], name)
+	}
+}
+
+// reportCacheStats prints how often the inspection cache and the ledger of
+// cleared commits saved work
+func reportCacheStats(s *scanner.Scanner) {
+	if stats := s.CacheStats(); stats.Hits+stats.Misses > 0 {
+		fmt.Printf("Inspection cache: %d hit(s), %d miss(es).\n", stats.Hits, stats.Misses)
+	}
+	if skipped := s.LedgerSkipped(); skipped > 0 {
+		fmt.Printf("Skipped %d commit(s) that already passed this policy; use -rescan to scan them again.\n", skipped)
+	}
+}
+
+// blocks reports whether result should fail the operation, noting findings
+// that Config.FailOn lets through
+func blocks(cfg *scanner.Config, result *scanner.Result) bool {
+	if result.Blocks(cfg.FailOn) {
+		return true
+	}
+	if !result.Sensitive() {
+		return false
+	}
+	if len(cfg.FailOn) > 0 {
+		fmt.Println(yellow(fmt.Sprintf("Sensitive data found, but none of the blocking info types (%s) with a blocking action at or above their likelihood thresholds; not blocking.", strings.Join(cfg.FailOn, ", "))))
 	} else {
-		fmt.Printf("Sensitive data found in file %s. Skipping git push.\n", filename)
+		fmt.Println(yellow("Sensitive data found, but only as warnings or below the likelihood thresholds; not blocking."))
 	}
+	return false
+}
 
-	return nil
+// probeTimeout bounds the reachability check made before scanning
+const probeTimeout = 5 * time.Second
+
+// interruptedExitCode is the conventional status for a process stopped by SIGINT
+const interruptedExitCode = 130
+
+// exitIfInterrupted exits with interruptedExitCode when the scan was stopped
+// by an interrupt, first summarizing what was scanned up to that point
+func exitIfInterrupted(ctx context.Context, partial *scanner.Result) {
+	if ctx.Err() == nil {
+		return
+	}
+	fmt.Println(yellow("Scan interrupted."))
+	if partial != nil {
+		scanned := len(partial.Files) - len(partial.SkippedFiles())
+		fmt.Printf("Scanned %d file(s) before the interrupt; %d had findings.\n", scanned, len(partial.Flagged()))
+		reportResult(partial)
+	}
+	os.Exit(interruptedExitCode)
 }
 
-func main() {
-	projectID := "datalake-sea-eng-us-cert"
+// exitOnErrors exits non-zero when operational errors left content unscanned,
+// or under Config.Strict when anything at all was left unscanned or DLP
+// truncated a file's findings. It is checked after findings, so a block for
+// sensitive data takes precedence.
+func exitOnErrors(s *scanner.Scanner, result *scanner.Result) {
+	if scanIncomplete(s, result) {
+		os.Exit(1)
+	}
+}
+
+// scanIncomplete reports, and prints why, when the result fails the scan as
+// exitOnErrors describes
+func scanIncomplete(s *scanner.Scanner, result *scanner.Result) bool {
+	if len(result.Errors) > 0 {
+		fmt.Fprintln(os.Stderr, red(fmt.Sprintf("No sensitive data found, but %d operational error(s) left content unscanned; see ERROR lines above.", len(result.Errors))))
+		return true
+	}
+	if !s.Config().Strict {
+		return false
+	}
+	if unscanned := len(result.Warnings) + len(result.Unscanned()); unscanned > 0 {
+		fmt.Fprintln(os.Stderr, red(fmt.Sprintf("Strict mode: %d file(s) or object(s) could not be scanned; see WARNING and Skipped lines above.", unscanned)))
+		return true
+	}
+	if truncated := len(s.TruncatedFiles()); truncated > 0 {
+		fmt.Fprintln(os.Stderr, red(fmt.Sprintf("Strict mode: findings in %d file(s) may be incomplete; see WARNING lines above.", truncated)))
+		return true
+	}
+	return false
+}
+
+// runRangeScan scans the commits in since..HEAD without pushing, exiting
+// non-zero when sensitive data is found
+func runRangeScan(ctx context.Context, s *scanner.Scanner, opts options, since string) {
+	commits, err := scanner.GetCommitsSince(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error retrieving commits: %v\n", err)
+		os.Exit(1)
+	}
 
-	files, err := GetChangedFiles()
+	fmt.Printf("Scanning %d commit(s) in %s..HEAD.\n", len(commits), since)
+	result, err := s.ScanCommits(ctx, commits)
 	if err != nil {
-		fmt.Printf("Error retrieving changed files: %v\n", err)
+		exitIfInterrupted(ctx, result)
+		printScanError(err)
 		os.Exit(1)
 	}
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, s.Config(), "range", result)
+	writeAttestation(opts, s.Config(), since, commits, result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	reportCacheStats(s)
+	if blocks(s.Config(), result) {
+		fmt.Println(red("Sensitive data detected in the commit range."))
+		os.Exit(1)
+	}
+	exitOnErrors(s, result)
+	fmt.Println(green("No sensitive data found in the commit range."))
+}
+
+// runRecentScan scans the last n unpushed commits and the final state of
+// their files without pushing, for a quick check during rapid iteration;
+// older unpushed commits are not scanned. It exits non-zero when sensitive
+// data is found.
+func runRecentScan(ctx context.Context, s *scanner.Scanner, opts options, n int) {
+	commits, err := scanner.GetRecentUnpushedCommits(n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error retrieving unpushed commits: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Scanning the last %d unpushed commit(s) and the final state of their files.\n", len(commits))
+	result, err := s.ScanPush(ctx, commits)
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, s.Config(), "last", result)
+	writeAttestation(opts, s.Config(), fmt.Sprintf("HEAD~%d", len(commits)), commits, result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	reportCacheStats(s)
+	if blocks(s.Config(), result) {
+		fmt.Println(red("Sensitive data detected in the recent commits."))
+		os.Exit(1)
+	}
+	exitOnErrors(s, result)
+	fmt.Println(green("No sensitive data found in the recent commits."))
+}
+
+// readFileList reads the newline-separated paths listed in path, or on
+// standard input when path is "-", ignoring blank lines
+func readFileList(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read file list %s: %v", path, err)
+	}
+	var files []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
 
+// runFilesScan scans the working-tree content of exactly the files listed in
+// listPath, as given by another tool, without asking git what changed, and
+// exits non-zero when sensitive data is found
+func runFilesScan(ctx context.Context, s *scanner.Scanner, opts options, listPath string) {
+	files, err := readFileList(listPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	for _, file := range files {
-		if file == "" {
+		if _, err := os.Stat(file); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: listed file %s: %v\n", file, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Scanning %d listed file(s).\n", len(files))
+	result, err := s.ScanFinalState(ctx, files)
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, s.Config(), "files", result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	reportCacheStats(s)
+	if blocks(s.Config(), result) {
+		fmt.Println(red("Sensitive data detected in the listed files."))
+		os.Exit(1)
+	}
+	exitOnErrors(s, result)
+	fmt.Println(green("No sensitive data found in the listed files."))
+}
+
+// runStorageScan inspects a Cloud Storage object in place, exiting non-zero
+// when sensitive data is found
+func runStorageScan(ctx context.Context, s *scanner.Scanner, jobs scanner.JobClient, opts options, url string) {
+	fmt.Printf("Starting DLP inspection job for %s.\n", url)
+	result, err := s.ScanStorage(ctx, jobs, url)
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, s.Config(), "gcs", result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	for _, f := range result.Files {
+		for name, count := range f.Stats {
+			fmt.Printf("  %s: %d %s finding(s)\n", f.Path, count, name)
+		}
+	}
+	if blocks(s.Config(), result) {
+		fmt.Println(red("Sensitive data detected in Cloud Storage content."))
+		os.Exit(1)
+	}
+	exitOnErrors(s, result)
+	fmt.Println(green("No sensitive data found in Cloud Storage content."))
+}
+
+// runRedactPreview scans the unpushed commits like a push would and prints
+// how redacting the findings would change each flagged file in the working
+// tree, without modifying anything or pushing
+func runRedactPreview(ctx context.Context, s *scanner.Scanner, opts options) {
+	commits, err := scanner.GetUnpushedCommits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error retrieving unpushed commits: %v\n", err)
+		os.Exit(1)
+	}
+	result, err := s.ScanPush(ctx, commits)
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	reportResult(result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	for _, f := range result.Flagged() {
+		// Only the final state is in the working tree to be redacted
+		if f.Commit != "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", f.Path, err)
+			os.Exit(1)
+		}
+		fmt.Print(scanner.RedactionDiff(f.Path, data, f.Findings, s.Config().Masking))
+	}
+}
+
+// runRedactOut scans the unpushed commits like a push would and writes a
+// redacted copy of each scanned file in the working tree under dir, at the
+// same relative path, leaving the originals and the push untouched. Files
+// that could not be scanned are not copied, nor are those whose redacted
+// content still has findings when inspected again, which fails the run.
+func runRedactOut(ctx context.Context, s *scanner.Scanner, opts options, dir string) {
+	commits, err := scanner.GetUnpushedCommits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error retrieving unpushed commits: %v\n", err)
+		os.Exit(1)
+	}
+	result, err := s.ScanPush(ctx, commits)
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	reportResult(result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	unclean := 0
+	for _, f := range result.Files {
+		// Only the final state is in the working tree to be copied
+		if f.Commit != "" || f.Skipped != "" {
 			continue
 		}
-		fmt.Printf("Scanning file: %s\n", file)
-		if err := ScanFile(file, projectID); err != nil {
-			fmt.Printf("Scan error: %v\n", err)
-			os.Exit(1) // Exit with non-zero status to block push
+		out := filepath.Join(dir, f.Path)
+		info, err := os.Stat(f.Path)
+		var data []byte
+		if err == nil {
+			data, err = ioutil.ReadFile(f.Path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", f.Path, err)
+			os.Exit(1)
 		}
+		redacted := scanner.Redact(data, f.Findings, s.Config().Masking)
+		if len(f.Findings) > 0 {
+			remaining, err := s.VerifyRedaction(ctx, f.Path, redacted)
+			if err != nil {
+				printScanError(err)
+				os.Exit(1)
+			}
+			if len(remaining) > 0 {
+				unclean++
+				fmt.Println(red(fmt.Sprintf("Not copying %s: %d finding(s) remain after redaction.", f.Path, len(remaining))))
+				for _, finding := range remaining {
+					fmt.Printf("  %s\n", describeFinding(f.Path, finding))
+				}
+				continue
+			}
+		}
+		err = os.MkdirAll(filepath.Dir(out), 0o755)
+		if err == nil {
+			err = ioutil.WriteFile(out, redacted, info.Mode().Perm())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing redacted copy of %s: %v\n", f.Path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s -> %s (%d finding(s) redacted)\n", f.Path, out, len(f.Findings))
+	}
+	if unclean > 0 {
+		fmt.Println(red(fmt.Sprintf("%d file(s) still held sensitive data after redaction; check the masking rules.", unclean)))
+		os.Exit(1)
+	}
+}
+
+// runStdinScan scans standard input, printing each finding and exiting
+// non-zero when sensitive data is found
+func runStdinScan(ctx context.Context, s *scanner.Scanner, opts options) {
+	runReaderScan(ctx, s, opts, "stdin", "<stdin>", os.Stdin, "standard input")
+}
+
+// runFileScan scans one file given to the scan subcommand, like runStdinScan.
+// Images are inspected with OCR.
+func runFileScan(ctx context.Context, s *scanner.Scanner, opts options, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	runReaderScan(ctx, s, opts, "file", path, f, path)
+}
+
+// runReaderScan scans the content of r as the file name, printing each
+// finding and exiting non-zero when sensitive data is found; source names
+// the content in the closing message
+func runReaderScan(ctx context.Context, s *scanner.Scanner, opts options, operation, name string, r io.Reader, source string) {
+	result, err := s.ScanReader(ctx, name, r)
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, s.Config(), operation, result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	for _, f := range result.Files {
+		for _, finding := range f.Findings {
+			if printableFinding() {
+				fmt.Printf("  %s (%s)\n", describeFinding(f.Path, finding), finding.Likelihood)
+			}
+		}
+	}
+	printOmittedFindings(os.Stdout)
+	if blocks(s.Config(), result) {
+		fmt.Println(red("Sensitive data detected in " + source + "."))
+		os.Exit(1)
+	}
+	exitOnErrors(s, result)
+	fmt.Println(green("No sensitive data found in " + source + "."))
+}
+
+// pushUnscanned runs git push without a scan after DLP turned out to be
+// unreachable under the fail-open policy
+func pushUnscanned(opts options, err error) {
+	fmt.Println(yellow(fmt.Sprintf("WARNING: DLP API is unreachable (%v).", err)))
+	fmt.Println(yellow("WARNING: failure policy is fail-open; pushing WITHOUT a DLP scan."))
+	if err := RunGitPush("", opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Push error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// allowUnscanned lets the push a pre-push hook was run for go ahead without
+// a scan after DLP turned out to be unreachable under the fail-open policy
+func allowUnscanned(err error) {
+	fmt.Println(yellow(fmt.Sprintf("WARNING: DLP API is unreachable (%v).", err)))
+	fmt.Println(yellow("WARNING: failure policy is fail-open; allowing the push WITHOUT a DLP scan."))
+}
+
+// protectedPushRefs reads the ref updates a pre-push hook is given on
+// standard input and returns those to protected branches, noting the others
+// as not scanned. Deletions push no content.
+func protectedPushRefs(cfg *scanner.Config) []scanner.PushRef {
+	refs, err := scanner.ReadPushRefs(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var protected []scanner.PushRef
+	for _, ref := range refs {
+		if ref.Deletion() {
+			continue
+		}
+		if !cfg.Protected(ref.Branch()) {
+			fmt.Printf("%s is not a protected branch; not scanning the push to it.\n", ref.RemoteRef)
+			continue
+		}
+		protected = append(protected, ref)
+	}
+	return protected
+}
+
+// runPrePushScan scans the commits a pre-push hook was told are being pushed
+// to protected branches and exits non-zero to have git abort the push
+func runPrePushScan(ctx context.Context, s *scanner.Scanner, opts options, refs []scanner.PushRef) {
+	cfg := s.Config()
+	var commits []string
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		pushed, err := scanner.GetPushedCommits(ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, commit := range pushed {
+			if !seen[commit] {
+				seen[commit] = true
+				commits = append(commits, commit)
+			}
+		}
+	}
+
+	fmt.Printf("Scanning %d commit(s) pushed to protected branches.\n", len(commits))
+	result, err := s.ScanCommits(ctx, commits)
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		if cfg.FailurePolicy == scanner.FailOpen && scanner.IsConnectivityError(err) {
+			allowUnscanned(err)
+			return
+		}
+		printScanError(err)
+		os.Exit(1)
+	}
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, cfg, "pre-push", result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	reportCacheStats(s)
+	if blocks(cfg, result) {
+		blockGitOperation(result)
+	}
+	exitOnErrors(s, result)
+	fmt.Println(green("No sensitive data found in the pushed commits."))
+}
+
+// runPushScan scans the unpushed commits and the final state of their files,
+// then either blocks or runs git push
+func runPushScan(ctx context.Context, s *scanner.Scanner, opts options) {
+	cfg := s.Config()
+	commits, err := scanner.GetUnpushedCommits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error retrieving unpushed commits: %v\n", err)
+		os.Exit(1)
+	}
+
+	if scanner.HistoryRewritten() {
+		fmt.Println(yellow("HEAD rewrites history on its upstream branch; scanning every commit not on the upstream, which a force push publishes."))
+		if !opts.forcePush {
+			fmt.Println(yellow("The push will be rejected unless -force-push is given."))
+		}
+	}
+	var result *scanner.Result
+	if cfg.CumulativeDiff {
+		base := scanner.GetPushBase()
+		fmt.Printf("Scanning the lines added by %d unpushed commit(s) as one diff from %s.\n", len(commits), base)
+		result, err = s.ScanCumulative(ctx, base)
+	} else {
+		fmt.Printf("Scanning %d unpushed commit(s) and the final state of their files.\n", len(commits))
+		result, err = s.ScanPush(ctx, commits)
+	}
+	if err != nil {
+		exitIfInterrupted(ctx, result)
+		if cfg.FailurePolicy == scanner.FailOpen && scanner.IsConnectivityError(err) {
+			pushUnscanned(opts, err)
+			return
+		}
+		printScanError(err)
+		os.Exit(1) // Exit with non-zero status to block push
+	}
+	// Never report clean, sign or push after an interrupt
+	exitIfInterrupted(ctx, result)
+	emitResult(opts, cfg, "push", result)
+	writeAttestation(opts, cfg, scanner.GetPushBase(), commits, result)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	reportCacheStats(s)
+	if blocks(cfg, result) {
+		redactWorkingTree(ctx, s, result)
+		blockGitOperation(result)
+	}
+	exitOnErrors(s, result)
+
+	fmt.Println(green("No sensitive data found. Proceeding with git push."))
+	header, err := scanHeader(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating scan attestation: %v\n", err)
+		os.Exit(1)
+	}
+	if err := RunGitPush(header, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Push error: %v\n", err)
+		os.Exit(1)
 	}
 	fmt.Println("DLP scan complete.")
 }
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		printVersion()
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "doctor" || os.Args[1] == "selftest") {
+		runDoctor(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "info-types" {
+		runInfoTypes(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		runPolicyTest(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	// "config show [flags]" is the same as "[flags] -print-config"
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "show" {
+		os.Args = append([]string{os.Args[0], "-print-config"}, os.Args[3:]...)
+	}
+	// "scan [flags] -" is the same as "[flags] -stdin"; "scan [flags] <file>"
+	// scans that one file
+	scanCommand := len(os.Args) > 1 && os.Args[1] == "scan"
+	if scanCommand {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	credentialsFile := flag.String("credentials", os.Getenv(credentialsEnvVar), "path to a service account JSON key file (defaults to $"+credentialsEnvVar+")")
+	configFile := flag.String("config", "", "path to a JSON scan config (defaults to "+scanner.DefaultConfigFile+" when present)")
+	failurePolicy := flag.String("failure-policy", "", "what to do when DLP is unreachable: \""+scanner.FailClosed+"\" blocks, \""+scanner.FailOpen+"\" warns and allows (overrides config)")
+	since := flag.String("since", "", "scan the commits in <rev>..HEAD and report, without pushing")
+	filterPath := flag.String("filter", "", "run as a git clean filter for this path: scan standard input and write it back to standard output, exiting non-zero on findings, without pushing")
+	last := flag.Int("last", 0, "scan only the last N unpushed commits and the final state of their files, and report, without pushing")
+	mergeBase := flag.Bool("merge-base", false, "scan only the commits HEAD adds since its merge base with the base ref, and report, without pushing")
+	baseRef := flag.String("base-ref", "", "branch -merge-base compares HEAD with (defaults to the upstream branch; overrides config)")
+	stdin := flag.Bool("stdin", false, "scan standard input instead of git content and report, without pushing (also given as a trailing \"-\")")
+	redactPreview := flag.Bool("redact-preview", false, "print a diff of how redacting the findings would change each flagged file, without modifying or pushing")
+	prePush := flag.Bool("pre-push", false, "run as a git pre-push hook: read the pushed refs from standard input, scan the commits going to protected branches, and exit non-zero to block, without pushing")
+	redactOut := flag.String("redact-out", "", "write redacted copies of the scanned files under this directory, keeping their relative paths, without modifying or pushing")
+	filesFrom := flag.String("files-from", "", "scan exactly the files listed one per line in this file (\"-\" for standard input) and report, without asking git what changed or pushing")
+	gcsPath := flag.String("gcs", "", "inspect a gs:// object in place with a DLP job and report, without pushing")
+	keepGoing := flag.Bool("keep-going", false, "collect git and file read errors and report them at the end instead of aborting on the first")
+	cumulative := flag.Bool("cumulative", false, "scan only the lines added by the unpushed commits, as one diff, instead of commit by commit")
+	includeQuote := flag.Bool("include-quote", false, "have findings carry and print the matched text (overrides config)")
+	strict := flag.Bool("strict", false, "block whenever anything could not be scanned, and never push unscanned (overrides config)")
+	failFast := flag.Bool("fail-fast", false, "stop at the first commit with sensitive data instead of reporting every flagged file")
+	fullScan := flag.Bool("full-scan", false, "scan files even when a commit only changes their whitespace")
+	concurrency := flag.Int("concurrency", 0, "maximum number of simultaneous DLP requests (overrides config)")
+	fileTimeout := flag.Int("file-timeout", -1, "seconds each DLP request may take before its files are marked timed out, 0 for no limit (overrides config)")
+	rescan := flag.Bool("rescan", false, "scan every commit again, ignoring the ledger of commits that already passed")
+	skipProbe := flag.Bool("skip-probe", false, "skip the DLP reachability check made before scanning")
+	poolSize := flag.Int("grpc-pool-size", 0, "number of gRPC connections to the DLP API (0 uses the library default)")
+	printConfigOnly := flag.Bool("print-config", false, "print the effective config after merging the config file, environment and flags, and exit (also \"config show\")")
+	var include listFlag
+	var repos listFlag
+	flag.Var(&repos, "repos", "scan each of these repository paths, comma-separated or repeated, and report, without pushing")
+	var failOn listFlag
+	flag.Var(&failOn, "fail-on", "only block on findings of these info types, comma-separated or repeated; others are reported (overrides config)")
+	flag.Var(&include, "include", "only scan files matching these globs, comma-separated or repeated (overrides config)")
+	var opts options
+	flag.StringVar(&opts.reportFile, "report-file", "", "also write the scan results as JSON to this path")
+	flag.IntVar(&maxFindingsToPrint, "max-findings-to-print", 0, "print at most this many findings to the console, summarizing the rest; reports still list them all (0 for no limit)")
+	flag.BoolVar(&opts.forcePush, "force-push", false, "push rewritten history with --force-with-lease, after scanning every commit the remote branch does not have")
+	flag.StringVar(&opts.format, "format", formatText, "\""+formatText+"\" for the console only, or \""+formatGitHub+"\" to also print findings as GitHub Actions annotations")
+	flag.BoolVar(&opts.timings, "timings", false, "print how long each scan phase took")
+	flag.BoolVar(&opts.quiet, "quiet", false, "print nothing but errors unless the scan blocks, and then only the findings, to standard error")
+	flag.StringVar(&opts.webhookURL, "webhook-url", "", "also POST the scan results as JSON to this URL")
+	flag.StringVar(&opts.attestationOut, "attestation-out", "", "write a JSON attestation of the scanned commit range, config hash and verdict to this path, signed when an attestation key is set")
+	flag.StringVar(&opts.attestationKeyFile, "attestation-key-file", os.Getenv(attestationKeyEnvVar), "HMAC key used to sign the scan attestation header and -attestation-out (defaults to $"+attestationKeyEnvVar+")")
+	flag.Parse()
+	// As a git filter, standard output carries the content back to git
+	filterOut := os.Stdout
+	if *filterPath != "" {
+		os.Stdout = os.Stderr
+	}
+	if opts.quiet {
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			os.Stdout = devNull
+		}
+	}
+	var scanFile string
+	if flag.NArg() == 1 && flag.Arg(0) == "-" {
+		*stdin = true
+	} else if scanCommand && flag.NArg() == 1 {
+		scanFile = flag.Arg(0)
+	}
+
+	configPath := *configFile
+	if configPath == "" {
+		configPath = scanner.DefaultConfigFile
+	}
+	cfg, err := scanner.LoadConfig(configPath, *configFile != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if *failurePolicy != "" {
+		cfg.FailurePolicy = *failurePolicy
+	}
+	if *fullScan {
+		cfg.ScanWhitespaceOnly = true
+	}
+	if *failFast {
+		cfg.FailFast = true
+	}
+	if *strict {
+		cfg.Strict = true
+	}
+	if *includeQuote {
+		cfg.IncludeQuote = true
+	}
+	if cfg.Strict {
+		cfg.FailurePolicy = scanner.FailClosed
+	}
+	if *baseRef != "" {
+		cfg.BaseRef = *baseRef
+	}
+	if *cumulative {
+		cfg.CumulativeDiff = true
+	}
+	if *keepGoing {
+		cfg.AccumulateErrors = true
+	}
+	if len(include) > 0 {
+		cfg.Include = include
+	}
+	if len(failOn) > 0 {
+		cfg.FailOn = failOn
+	}
+	if *concurrency != 0 {
+		cfg.Concurrency = *concurrency
+	}
+	if *fileTimeout >= 0 {
+		cfg.FileTimeoutSeconds = *fileTimeout
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in flags: %v\n", err)
+		os.Exit(1)
+	}
+	if *last < 0 {
+		fmt.Fprintln(os.Stderr, "Error in flags: -last must not be negative")
+		os.Exit(1)
+	}
+	if opts.format != formatText && opts.format != formatGitHub {
+		fmt.Fprintf(os.Stderr, "Error in flags: -format must be %q or %q\n", formatText, formatGitHub)
+		os.Exit(1)
+	}
+	if opts.quiet && opts.format == formatGitHub {
+		fmt.Fprintln(os.Stderr, "Error in flags: -quiet discards the annotations of -format=github")
+		os.Exit(1)
+	}
+	if *printConfigOnly {
+		if err := printConfig(cfg, configPath, *credentialsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if !*stdin && scanFile == "" && *filterPath == "" && *filesFrom == "" && *gcsPath == "" && len(repos) == 0 {
+		if err := scanner.CheckGitRepository(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Pushes to branches outside Config.ProtectedBranches go through unscanned
+	var pushRefs []scanner.PushRef
+	if *prePush {
+		pushRefs = protectedPushRefs(cfg)
+		if len(pushRefs) == 0 {
+			return
+		}
+	}
+	pushMode := !*prePush && !*stdin && scanFile == "" && *filterPath == "" && *filesFrom == "" && *gcsPath == "" && *since == "" && *last == 0 && !*mergeBase && !*redactPreview && *redactOut == "" && len(repos) == 0
+	if pushMode && len(cfg.ProtectedBranches) > 0 {
+		branch, err := scanner.GetPushTarget()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !cfg.Protected(branch) {
+			fmt.Printf("%s is not a protected branch; pushing without a DLP scan.\n", branch)
+			if err := RunGitPush("", opts); err != nil {
+				fmt.Fprintf(os.Stderr, "Push error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	// Ctrl-C cancels the scan, which then reports what it got through
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	clientOpts := scanner.DefaultClientOptions()
+	clientOpts.CredentialsFile = *credentialsFile
+	clientOpts.PoolSize = *poolSize
+	client, err := scanner.NewClient(ctx, clientOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating DLP client: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	if !*skipProbe {
+		if err := scanner.Probe(ctx, client, probeTimeout); err != nil {
+			if pushMode && cfg.FailurePolicy == scanner.FailOpen && scanner.IsConnectivityError(err) {
+				pushUnscanned(opts, err)
+				return
+			}
+			if *prePush && cfg.FailurePolicy == scanner.FailOpen && scanner.IsConnectivityError(err) {
+				allowUnscanned(err)
+				return
+			}
+			if *filterPath != "" && cfg.FailurePolicy == scanner.FailOpen && scanner.IsConnectivityError(err) {
+				stageUnscanned(filterOut, os.Stdin, *filterPath, err)
+				return
+			}
+			printScanError(err)
+			os.Exit(1)
+		}
+	}
+
+	warnings, err := cfg.CheckInfoTypes(ctx, client)
+	if err != nil {
+		if cfg.Strict {
+			fmt.Fprintf(os.Stderr, "Error: could not validate configured info types: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("WARNING: could not validate configured info types: %v\n", err)
+	}
+	for _, w := range warnings {
+		fmt.Println(yellow("WARNING: " + w))
+	}
+	s := scanner.New(client, cfg)
+	ownFiles := []string{configPath, *credentialsFile, opts.attestationKeyFile, opts.reportFile, opts.attestationOut}
+	if root, err := scanner.GetRepositoryRoot(); err == nil {
+		s.ExcludeOwnFiles(root, ownFiles...)
+		ledger, err := scanner.OpenLedger(cfg)
+		if err != nil {
+			fmt.Println(yellow(fmt.Sprintf("WARNING: %v", err)))
+		} else {
+			if *rescan {
+				ledger.Forget()
+			}
+			s.UseLedger(ledger)
+		}
+	}
+
+	if *prePush {
+		runPrePushScan(ctx, s, opts, pushRefs)
+		return
+	}
+	if *stdin {
+		runStdinScan(ctx, s, opts)
+		return
+	}
+	if *filterPath != "" {
+		runFilterScan(ctx, s, opts, *filterPath, filterOut)
+		return
+	}
+	if scanFile != "" {
+		runFileScan(ctx, s, opts, scanFile)
+		return
+	}
+	if *filesFrom != "" {
+		runFilesScan(ctx, s, opts, *filesFrom)
+		return
+	}
+	if len(repos) > 0 {
+		runMultiRepoScan(ctx, s, opts, repos, *since, *rescan, ownFiles)
+		return
+	}
+	if *gcsPath != "" {
+		runStorageScan(ctx, s, client, opts, *gcsPath)
+		return
+	}
+	if *mergeBase {
+		base, err := scanner.GetMergeBase(cfg.BaseRef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		*since = base
+	}
+	if *since != "" {
+		runRangeScan(ctx, s, opts, *since)
+		return
+	}
+	if *last > 0 {
+		runRecentScan(ctx, s, opts, *last)
+		return
+	}
+	if *redactPreview {
+		runRedactPreview(ctx, s, opts)
+		return
+	}
+	if *redactOut != "" {
+		runRedactOut(ctx, s, opts, *redactOut)
+		return
+	}
+	runPushScan(ctx, s, opts)
+}
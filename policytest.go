@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"dlp-test/scanner"
+)
+
+// policySample is a labeled string a config is expected to detect
+type policySample struct {
+	Text     string `json:"text"`
+	InfoType string `json:"infoType"`
+}
+
+// loadPolicySamples reads a JSON array of samples
+func loadPolicySamples(path string) ([]policySample, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read samples %s: %v", path, err)
+	}
+	var samples []policySample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("could not parse samples %s: %v", path, err)
+	}
+	for i, sample := range samples {
+		if sample.Text == "" || sample.InfoType == "" {
+			return nil, fmt.Errorf("sample %d in %s needs both text and infoType", i+1, path)
+		}
+	}
+	return samples, nil
+}
+
+// runPolicyTest checks that the current config detects each labeled sample
+// as its expected info type, for policy authors validating a config change.
+// It exits non-zero when any sample is missed.
+func runPolicyTest(args []string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	credentialsFile := fs.String("credentials", os.Getenv(credentialsEnvVar), "path to a service account JSON key file (defaults to $"+credentialsEnvVar+")")
+	configFile := fs.String("config", "", "path to a JSON scan config (defaults to "+scanner.DefaultConfigFile+" when present)")
+	samplesFile := fs.String("samples", "", "JSON array of {\"text\", \"infoType\"} samples the config should detect")
+	fs.Parse(args)
+	if *samplesFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: -samples is required")
+		os.Exit(1)
+	}
+
+	samples, err := loadPolicySamples(*samplesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	configPath := *configFile
+	if configPath == "" {
+		configPath = scanner.DefaultConfigFile
+	}
+	cfg, err := scanner.LoadConfig(configPath, *configFile != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	clientOpts := scanner.DefaultClientOptions()
+	clientOpts.CredentialsFile = *credentialsFile
+	client, err := scanner.NewClient(ctx, clientOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating DLP client: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	s := scanner.New(client, cfg)
+	missed := 0
+	for i, sample := range samples {
+		result, err := s.ScanReader(ctx, fmt.Sprintf("sample %d", i+1), strings.NewReader(sample.Text))
+		if err != nil {
+			printScanError(err)
+			os.Exit(1)
+		}
+		found := result.Files[0].InfoTypes()
+		detected := false
+		for _, name := range found {
+			if name == sample.InfoType {
+				detected = true
+			}
+		}
+		if detected {
+			fmt.Printf("[ok]   sample %d: %s detected\n", i+1, sample.InfoType)
+			continue
+		}
+		missed++
+		if len(found) == 0 {
+			fmt.Println(red(fmt.Sprintf("[MISS] sample %d: %s not detected (nothing found)", i+1, sample.InfoType)))
+		} else {
+			fmt.Println(red(fmt.Sprintf("[MISS] sample %d: %s not detected (found %s)", i+1, sample.InfoType, strings.Join(found, ", "))))
+		}
+	}
+	if missed > 0 {
+		fmt.Println(red(fmt.Sprintf("%d of %d sample(s) missed under %s.", missed, len(samples), configPath)))
+		os.Exit(1)
+	}
+	fmt.Println(green(fmt.Sprintf("All %d sample(s) detected.", len(samples))))
+}
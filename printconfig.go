@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"dlp-test/scanner"
+)
+
+// printConfig prints where the configuration came from and the effective
+// config after the file, environment and flags were merged, for debugging
+// which setting is in effect
+func printConfig(cfg *scanner.Config, configPath, credentialsFile string) error {
+	if _, err := os.Stat(configPath); err == nil {
+		fmt.Printf("# Config file: %s\n", configPath)
+	} else {
+		fmt.Printf("# Config file: %s not found; using the defaults\n", configPath)
+	}
+	switch {
+	case credentialsFile == "":
+		fmt.Println("# Credentials: application default credentials")
+	case credentialsFile == os.Getenv(credentialsEnvVar):
+		fmt.Printf("# Credentials: %s (from $%s)\n", credentialsFile, credentialsEnvVar)
+	default:
+		fmt.Printf("# Credentials: %s\n", credentialsFile)
+	}
+	fmt.Printf("# DLP parent: %s\n", cfg.ParentPath())
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode config: %v", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
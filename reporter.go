@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"dlp-test/scanner"
+)
+
+// Reporter emits the outcome of a scan somewhere: the console, a file, a service
+type Reporter interface {
+	// Report emits result of the given operation (e.g. "push"); blocked
+	// records whether it fails the operation
+	Report(operation string, result *scanner.Result, blocked bool) error
+}
+
+// consoleReporter prints the result for a person at a terminal
+type consoleReporter struct {
+	cfg *scanner.Config
+}
+
+// Report prints the warnings, errors, skipped and flagged files of result
+// and its risk score
+func (r consoleReporter) Report(operation string, result *scanner.Result, blocked bool) error {
+	reportResult(result)
+	if result.Sensitive() {
+		fmt.Printf("Risk score: %.1f.\n", r.cfg.RiskScore(result))
+	}
+	return nil
+}
+
+// quietReporter prints nothing unless the result blocks, and then only the
+// blocking findings, to standard error; see -quiet
+type quietReporter struct{}
+
+// Report prints the findings of a blocked result
+func (quietReporter) Report(operation string, result *scanner.Result, blocked bool) error {
+	if !blocked {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Sensitive data detected; blocking %s.\n", operation)
+	for _, f := range result.Flagged() {
+		for _, finding := range f.Findings {
+			if printableFinding() {
+				fmt.Fprintf(os.Stderr, "  %s\n", describeFinding(f.Path, finding))
+			}
+		}
+		for name, count := range f.Stats {
+			fmt.Fprintf(os.Stderr, "  %s: %d %s finding(s)\n", f.Path, count, name)
+		}
+	}
+	printOmittedFindings(os.Stderr)
+	return nil
+}
+
+// newScanReport builds the JSON report for result in the current repository
+func newScanReport(cfg *scanner.Config, operation string, result *scanner.Result, blocked bool) *scanner.Report {
+	repository, err := scanner.GetRepositoryRoot()
+	if err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+	}
+	return scanner.NewReport(operation, repository, result, blocked, cfg.RiskScore(result))
+}
+
+// jsonFileReporter writes the JSON report to a file
+type jsonFileReporter struct {
+	cfg  *scanner.Config
+	path string
+}
+
+// Report writes the report for result to the reporter's path
+func (r jsonFileReporter) Report(operation string, result *scanner.Result, blocked bool) error {
+	if err := newScanReport(r.cfg, operation, result, blocked).WriteFile(r.path); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote scan report to %s.\n", r.path)
+	return nil
+}
+
+// webhookTimeout bounds the request that delivers a report to a webhook
+const webhookTimeout = 10 * time.Second
+
+// webhookReporter POSTs the JSON report to a URL
+type webhookReporter struct {
+	cfg    *scanner.Config
+	url    string
+	client *http.Client
+}
+
+// newWebhookReporter returns a reporter that delivers reports to url
+func newWebhookReporter(cfg *scanner.Config, url string) webhookReporter {
+	return webhookReporter{cfg: cfg, url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Report sends the report for result, failing unless the webhook answers 2xx
+func (r webhookReporter) Report(operation string, result *scanner.Result, blocked bool) error {
+	return r.post(newScanReport(r.cfg, operation, result, blocked))
+}
+
+// post sends v as JSON, failing unless the webhook answers 2xx
+func (r webhookReporter) post(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode report: %v", err)
+	}
+	resp, err := r.client.Post(r.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("could not deliver report to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s rejected the report: %s", r.url, resp.Status)
+	}
+	return nil
+}
+
+// githubReporter prints GitHub Actions workflow commands, so findings show
+// as annotations on the run and on the pull request diff; see -format
+type githubReporter struct {
+	cfg *scanner.Config
+}
+
+// Report prints an error annotation for each blocking finding and a warning
+// for each other one. Matched text is left out, since annotations are
+// visible to everyone who can read the run.
+func (r githubReporter) Report(operation string, result *scanner.Result, blocked bool) error {
+	for _, f := range result.Files {
+		for _, finding := range f.Findings {
+			level := "warning"
+			if finding.Blocks(r.cfg.FailOn) {
+				level = "error"
+			}
+			properties := "file=" + escapeProperty(f.Path)
+			if finding.Line > 0 {
+				properties += fmt.Sprintf(",line=%d,col=%d", finding.Line, finding.Column)
+			}
+			properties += ",title=" + escapeProperty("DLP: "+finding.InfoType)
+			message := fmt.Sprintf("%s (%s) found", finding.InfoType, finding.Likelihood)
+			if f.Commit != "" {
+				message += fmt.Sprintf(" in commit %.8s", f.Commit)
+			}
+			if finding.InPath {
+				message += " in the file path"
+			}
+			if finding.Context {
+				message += " on a line the change did not add"
+			}
+			fmt.Printf("::%s %s::%s\n", level, properties, escapeData(message))
+		}
+		for name, count := range f.Stats {
+			level := "warning"
+			if stat := (scanner.Finding{InfoType: name, Action: f.StatActions[name]}); count > 0 && stat.Blocks(r.cfg.FailOn) {
+				level = "error"
+			}
+			fmt.Printf("::%s title=%s::%s\n", level, escapeProperty("DLP: "+name), escapeData(fmt.Sprintf("%s: %d %s finding(s)", f.Path, count, name)))
+		}
+	}
+	return nil
+}
+
+// escapeData escapes the message of a workflow command
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a property value of a workflow command
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// multiReporter emits to each of its reporters in turn. Every reporter runs
+// even if an earlier one fails; the first error is returned.
+type multiReporter []Reporter
+
+// Report emits result to every reporter
+func (m multiReporter) Report(operation string, result *scanner.Result, blocked bool) error {
+	var first error
+	for _, r := range m {
+		if err := r.Report(operation, result, blocked); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// newReporter returns the reporters selected by the command-line options:
+// the console, or its quiet form, plus GitHub annotations, the report file
+// and webhook when set
+func newReporter(opts options, cfg *scanner.Config) Reporter {
+	reporters := multiReporter{consoleReporter{cfg: cfg}}
+	if opts.quiet {
+		reporters = multiReporter{quietReporter{}}
+	}
+	if opts.format == formatGitHub {
+		reporters = append(reporters, githubReporter{cfg: cfg})
+	}
+	if opts.reportFile != "" {
+		reporters = append(reporters, jsonFileReporter{cfg: cfg, path: opts.reportFile})
+	}
+	if opts.webhookURL != "" {
+		reporters = append(reporters, newWebhookReporter(cfg, opts.webhookURL))
+	}
+	return reporters
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"dlp-test/scanner"
+)
+
+// runMultiRepoScan scans each repository in turn with one client and
+// scanner, without pushing: the commits in since..HEAD when since is set,
+// otherwise the unpushed commits and the final state of their files. Results
+// are printed per repository and the report file and webhook get one
+// combined report. Each repository gets the checks of a single scan: ownFiles,
+// the scanner's config and credential files, are excluded from it, redact
+// findings are redacted in its working tree when it blocks, and operational
+// errors, or under Config.Strict anything unscanned, fail it. It exits
+// non-zero if any repository fails.
+func runMultiRepoScan(ctx context.Context, s *scanner.Scanner, opts options, repos []string, since string, rescan bool, ownFiles []string) {
+	cfg := s.Config()
+	start, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// The paths are relative to the starting directory, not each repository
+	var ownPaths []string
+	for _, path := range ownFiles {
+		if path == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			ownPaths = append(ownPaths, abs)
+		}
+	}
+	operation := "push"
+	if since != "" {
+		operation = "range"
+	}
+
+	combined := scanner.NewCombinedReport()
+	failed := false
+	for _, repo := range repos {
+		fmt.Printf("== %s ==\n", repo)
+		path := repo
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(start, repo)
+		}
+		if err := os.Chdir(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := scanner.CheckGitRepository(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		root, _ := scanner.GetRepositoryRoot()
+		s.ExcludeOwnFiles(root, ownPaths...)
+		// Each repository keeps its own ledger of cleared commits
+		if ledger, err := scanner.OpenLedger(cfg); err == nil {
+			if rescan {
+				ledger.Forget()
+			}
+			s.UseLedger(ledger)
+		}
+
+		var commits []string
+		if since != "" {
+			commits, err = scanner.GetCommitsSince(since)
+		} else {
+			commits, err = scanner.GetUnpushedCommits()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error retrieving commits: %v\n", err)
+			os.Exit(1)
+		}
+		var result *scanner.Result
+		if since != "" {
+			result, err = s.ScanCommits(ctx, commits)
+		} else {
+			result, err = s.ScanPush(ctx, commits)
+		}
+		if err != nil {
+			exitIfInterrupted(ctx, result)
+			printScanError(err)
+			os.Exit(1)
+		}
+		exitIfInterrupted(ctx, result)
+
+		reportResult(result)
+		blocked := blocks(cfg, result)
+		if blocked {
+			if since == "" {
+				redactWorkingTree(ctx, s, result)
+			}
+			fmt.Println(red(fmt.Sprintf("Sensitive data detected in %s.", repo)))
+		}
+		// A block for sensitive data takes precedence, as in a single scan
+		if blocked || scanIncomplete(s, result) {
+			failed = true
+		}
+		combined.Add(scanner.NewReport(operation, root, result, blocked, cfg.RiskScore(result)))
+	}
+	os.Chdir(start)
+	reportSuppressed(s)
+	reportTimings(opts, s)
+	reportCacheStats(s)
+
+	if opts.reportFile != "" {
+		if err := combined.WriteFile(opts.reportFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote combined scan report to %s.\n", opts.reportFile)
+	}
+	if opts.webhookURL != "" {
+		if err := newWebhookReporter(cfg, opts.webhookURL).post(combined); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println(green(fmt.Sprintf("No sensitive data found in %d repositories.", len(repos))))
+}
@@ -0,0 +1,600 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+)
+
+// maxRequestBytes keeps each InspectContent payload safely under the DLP 0.5 MB request limit
+const maxRequestBytes = 500 * 1000
+
+// content is one file's data queued for inspection
+type content struct {
+	path string
+	data []byte
+}
+
+// batchEntry records where one file's content sits inside a concatenated batch
+type batchEntry struct {
+	path  string
+	start int64
+	end   int64
+	// origin is the offset of this content within the file, non-zero for
+	// all but the first window of a chunked file
+	origin int64
+}
+
+// batch is a set of small files concatenated into a single DLP request
+type batch struct {
+	text    strings.Builder
+	entries []batchEntry
+}
+
+// batchDelimiter returns the marker written in front of each file in a batch
+func batchDelimiter(path string) string {
+	return fmt.Sprintf("\n----- DLP BATCH FILE: %s -----\n", path)
+}
+
+// add appends a file's content to the batch behind its delimiter marker
+func (b *batch) add(path string, data []byte) {
+	b.text.WriteString(batchDelimiter(path))
+	start := int64(b.text.Len())
+	b.text.Write(data)
+	b.entries = append(b.entries, batchEntry{path: path, start: start, end: int64(b.text.Len())})
+}
+
+// entryFor maps a byte offset in the batch back to the originating file
+func (b *batch) entryFor(offset int64) (batchEntry, bool) {
+	for _, e := range b.entries {
+		if offset >= e.start && offset < e.end {
+			return e, true
+		}
+	}
+	// The offset falls inside a delimiter marker rather than file content
+	return batchEntry{}, false
+}
+
+// scanContents inspects the given contents like inspectContents, reusing
+// cached findings for content already inspected under the same configuration,
+// dropping findings of excluded info types and adding line and column
+// numbers
+func (s *Scanner) scanContents(ctx context.Context, contents []content) (map[string][]Finding, map[string]string, error) {
+	results, skipped, err := s.cachedContents(ctx, contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, c := range contents {
+		findings := s.excludeFindings(results[c.path])
+		_, isDocument := documentBytesType(c.path, c.data)
+		if !isDocument {
+			markRegions(c.path, c.data, findings)
+		}
+		for i := range findings {
+			setFingerprint(&findings[i], c.path, c.data, !isDocument)
+			s.applyPolicy(&findings[i])
+			if !isDocument {
+				findings[i].Line, findings[i].Column = lineColumn(c.data, findings[i].Start)
+			}
+		}
+		results[c.path] = findings
+	}
+	return results, skipped, nil
+}
+
+// applyPolicy sets the fields of a finding that depend on the config rather
+// than on the content
+func (s *Scanner) applyPolicy(f *Finding) {
+	f.Category = s.config.CategoryOf(f.InfoType)
+	f.Informational = s.config.Informational(f.InfoType, f.Likelihood)
+	f.Action = s.config.ActionFor(f.InfoType)
+	if !s.config.IncludeQuote {
+		// Local detectors always know the match
+		f.Quote = ""
+	}
+}
+
+// excludeFindings drops findings whose info type is in
+// Config.ExcludeInfoTypes, counting them by type
+func (s *Scanner) excludeFindings(findings []Finding) []Finding {
+	if len(s.config.ExcludeInfoTypes) == 0 {
+		return findings
+	}
+	kept := findings[:0]
+	for _, f := range findings {
+		if !s.config.Excluded(f.InfoType) {
+			kept = append(kept, f)
+			continue
+		}
+		s.mu.Lock()
+		s.suppressed[f.InfoType]++
+		s.mu.Unlock()
+	}
+	return kept
+}
+
+// SuppressedCounts returns how many findings of each excluded info type were
+// dropped so far
+func (s *Scanner) SuppressedCounts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int, len(s.suppressed))
+	for name, n := range s.suppressed {
+		counts[name] = n
+	}
+	return counts
+}
+
+// cachedContents inspects the given contents like inspectContents, reusing
+// cached findings for content already inspected under the same inspect
+// configuration
+func (s *Scanner) cachedContents(ctx context.Context, contents []content) (map[string][]Finding, map[string]string, error) {
+	if s.cache == nil {
+		return s.inspectContents(ctx, contents)
+	}
+
+	results := make(map[string][]Finding)
+	keys := make(map[string]string)
+	// Files under one rule set share an inspect configuration
+	configHashes := make(map[string]string)
+	var pending []content
+	for _, c := range contents {
+		ruleSet := s.config.RuleSetFor(c.path)
+		if _, ok := configHashes[ruleSet]; !ok {
+			configHashes[ruleSet] = s.config.inspectConfigHash(c.path)
+		}
+		key := cacheKey(configHashes[ruleSet], c)
+		if findings, truncated, ok := s.cache.get(key); ok {
+			results[c.path] = findings
+			if truncated {
+				s.markTruncated(c.path)
+			}
+			continue
+		}
+		keys[c.path] = key
+		pending = append(pending, c)
+	}
+
+	found, skipped, err := s.inspectContents(ctx, pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, c := range pending {
+		if _, ok := skipped[c.path]; ok {
+			continue
+		}
+		results[c.path] = found[c.path]
+		s.cache.put(keys[c.path], found[c.path], s.isTruncated(c.path))
+	}
+	return results, skipped, nil
+}
+
+// inspectContents inspects the given contents, grouping files by the info type
+// set that applies to their path. JSON and YAML files are inspected in their
+// flattened form so values are seen next to their key names, and PDFs,
+// office documents and images as typed bytes. Source files are cut down to
+// the regions in Config.ScanRegions. Local detector findings are merged with
+// the DLP ones. The result maps each path to its findings; paths that could
+// not be inspected are returned separately with the reason.
+func (s *Scanner) inspectContents(ctx context.Context, contents []content) (map[string][]Finding, map[string]string, error) {
+	results := make(map[string][]Finding)
+	skipped := make(map[string]string)
+
+	var docs []content
+	texts := contents[:0:0]
+	for _, c := range contents {
+		if _, ok := documentBytesType(c.path, c.data); ok {
+			docs = append(docs, c)
+			continue
+		}
+		if s.config.ScanRegions != RegionAll {
+			// Offsets are kept, so findings need no mapping back
+			if spans, ok := commentSpans(c.path, c.data); ok {
+				c = content{path: c.path, data: keepRegion(c.data, spans, s.config.ScanRegions)}
+			}
+		}
+		texts = append(texts, c)
+	}
+	if err := s.inspectDocuments(ctx, docs, results, skipped); err != nil {
+		return nil, nil, err
+	}
+	contents = texts
+
+	for _, d := range s.detectors {
+		for _, c := range contents {
+			results[c.path] = append(results[c.path], d.Detect(c.data)...)
+		}
+	}
+
+	var ruleSets []string
+	groups := make(map[string][]content)
+	structured := make(map[string]*flattened)
+	for _, c := range contents {
+		// With only comments left there are no values to flatten
+		if flat, ok := flattenStructured(c.path, c.data); ok && s.config.ScanRegions != RegionComment {
+			structured[c.path] = flat
+			c = content{path: c.path, data: flat.text.Bytes()}
+		}
+		ruleSet := s.config.RuleSetFor(c.path)
+		if _, ok := groups[ruleSet]; !ok {
+			ruleSets = append(ruleSets, ruleSet)
+		}
+		groups[ruleSet] = append(groups[ruleSet], c)
+	}
+
+	dlpResults := make(map[string][]Finding)
+	for _, ruleSet := range ruleSets {
+		group := groups[ruleSet]
+		inspectConfig := s.config.InspectConfigForPath(group[0].path)
+		if err := s.scanBatched(ctx, inspectConfig, group, dlpResults, skipped); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for path, flat := range structured {
+		for i := range dlpResults[path] {
+			flat.locate(&dlpResults[path][i])
+		}
+	}
+	for path, findings := range dlpResults {
+		results[path] = append(results[path], findings...)
+	}
+	for _, findings := range results {
+		for i := range findings {
+			findings[i].Category = s.config.CategoryOf(findings[i].InfoType)
+		}
+	}
+	return results, skipped, nil
+}
+
+// single wraps one file's content in a batch of its own, without a delimiter
+func single(path string, data []byte) *batch {
+	b := &batch{}
+	b.text.Write(data)
+	b.entries = []batchEntry{{path: path, start: 0, end: int64(len(data))}}
+	return b
+}
+
+// requestContext bounds a single DLP request by Config.FileTimeoutSeconds
+func (s *Scanner) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.FileTimeoutSeconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(s.config.FileTimeoutSeconds)*time.Second)
+}
+
+// documentBytesTypes maps the extensions of binary document and image formats
+// DLP can parse to the bytes type it expects them as. Images are inspected
+// with OCR.
+var documentBytesTypes = map[string]dlppb.ByteContentItem_BytesType{
+	".pdf":  dlppb.ByteContentItem_PDF,
+	".docx": dlppb.ByteContentItem_WORD_DOCUMENT,
+	".pptx": dlppb.ByteContentItem_POWERPOINT_DOCUMENT,
+	".xlsx": dlppb.ByteContentItem_EXCEL_DOCUMENT,
+	".png":  dlppb.ByteContentItem_IMAGE_PNG,
+	".jpg":  dlppb.ByteContentItem_IMAGE_JPEG,
+	".jpeg": dlppb.ByteContentItem_IMAGE_JPEG,
+	".bmp":  dlppb.ByteContentItem_IMAGE_BMP,
+	".svg":  dlppb.ByteContentItem_IMAGE_SVG,
+}
+
+// imageMIMETypes maps sniffed image MIME types to their bytes type, for
+// content whose name has no recognised extension, such as standard input
+var imageMIMETypes = map[string]dlppb.ByteContentItem_BytesType{
+	"image/png":  dlppb.ByteContentItem_IMAGE_PNG,
+	"image/jpeg": dlppb.ByteContentItem_IMAGE_JPEG,
+	"image/bmp":  dlppb.ByteContentItem_IMAGE_BMP,
+}
+
+// documentBytesType returns the bytes type for a document or image, if DLP
+// parses that format, going by the path's extension and then by sniffing
+// data for an image
+func documentBytesType(path string, data []byte) (dlppb.ByteContentItem_BytesType, bool) {
+	if bytesType, ok := documentBytesTypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return bytesType, true
+	}
+	bytesType, ok := imageMIMETypes[http.DetectContentType(data)]
+	return bytesType, ok
+}
+
+// inspectDocuments inspects PDFs and office documents one request each, sent
+// as bytes of their type so DLP parses the text out of them rather than
+// seeing the raw file. Documents cannot be batched or chunked, so one over
+// the request limit is skipped.
+func (s *Scanner) inspectDocuments(ctx context.Context, docs []content, results map[string][]Finding, skipped map[string]string) error {
+	for _, d := range docs {
+		if len(d.data) > maxRequestBytes {
+			skipped[d.path] = SkippedOversized
+			continue
+		}
+		bytesType, _ := documentBytesType(d.path, d.data)
+		item := &dlppb.ContentItem{DataItem: &dlppb.ContentItem_ByteItem{
+			ByteItem: &dlppb.ByteContentItem{Type: bytesType, Data: d.data},
+		}}
+
+		reqCtx, cancel := s.requestContext(ctx)
+		findings, truncated, err := s.inspectItem(reqCtx, s.config.InspectConfigForPath(d.path), item)
+		expired := reqCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if err != nil {
+			if expired {
+				skipped[d.path] = SkippedTimedOut
+				continue
+			}
+			return fmt.Errorf("%s: %w", d.path, err)
+		}
+		if truncated {
+			// Documents cannot be split to rescan them
+			s.markTruncated(d.path)
+		}
+		for _, f := range findings {
+			results[d.path] = append(results[d.path], newFinding(f, 0))
+		}
+	}
+	return nil
+}
+
+// chunk splits content too large for one request into windows of at most
+// maxRequestBytes, each inspected on its own. Windows end at the last newline
+// they contain, so only single-line content such as minified bundles is cut
+// mid-line. Each window after the first starts overlap bytes before the end
+// of the previous one, so a match shorter than the overlap that straddles a
+// boundary is still whole in one window; see Config.ChunkOverlapBytes.
+func chunk(path string, data []byte, overlap int) []*batch {
+	var batches []*batch
+	for origin := 0; origin < len(data); {
+		end := origin + maxRequestBytes
+		if end >= len(data) {
+			end = len(data)
+		} else if nl := bytes.LastIndexByte(data[origin:end], '\n'); nl > 0 {
+			end = origin + nl + 1
+		}
+		b := single(path, data[origin:end])
+		b.entries[0].origin = int64(origin)
+		batches = append(batches, b)
+		if end < len(data) && end-overlap > origin {
+			origin = end - overlap
+		} else {
+			origin = end
+		}
+	}
+	return batches
+}
+
+// minRescanBytes is the size below which rescanTruncated stops splitting
+const minRescanBytes = 4 * 1000
+
+// split divides a batch for a rescan: into one batch per file, or for a
+// single file into two halves cut at a line end, the second starting overlap
+// bytes early. It returns nil when the batch is too small to split.
+func (b *batch) split(overlap int) []*batch {
+	text := b.text.String()
+	if len(b.entries) > 1 {
+		var pieces []*batch
+		for _, e := range b.entries {
+			piece := single(e.path, []byte(text[e.start:e.end]))
+			piece.entries[0].origin = e.origin
+			pieces = append(pieces, piece)
+		}
+		return pieces
+	}
+	e := b.entries[0]
+	data := []byte(text[e.start:e.end])
+	if len(data) < 2*minRescanBytes {
+		return nil
+	}
+	cut := len(data) / 2
+	if nl := bytes.LastIndexByte(data[:cut], '\n'); nl > 0 {
+		cut = nl + 1
+	}
+	second := cut - overlap
+	if second <= 0 {
+		second = cut
+	}
+	first := single(e.path, data[:cut])
+	first.entries[0].origin = e.origin
+	last := single(e.path, data[second:])
+	last.entries[0].origin = e.origin + int64(second)
+	return []*batch{first, last}
+}
+
+// addFindings adds the DLP findings of the batch's text to results by path,
+// with offsets within each file
+func (b *batch) addFindings(results map[string][]Finding, found []templateFinding) {
+	for _, finding := range found {
+		entry, ok := b.entryFor(finding.GetLocation().GetByteRange().GetStart())
+		if !ok {
+			continue
+		}
+		results[entry.path] = append(results[entry.path], newFinding(finding, entry.start-entry.origin))
+	}
+}
+
+// rescanTruncated handles a batch whose findings DLP truncated. Under
+// Config.RescanTruncated its content is inspected again in smaller pieces,
+// see split, and pieces still truncated are split again, adding the findings
+// to results. Files whose findings may remain incomplete, because the
+// pieces got too small or ran out of time, are recorded for TruncatedFiles.
+func (s *Scanner) rescanTruncated(ctx context.Context, inspectConfig *dlppb.InspectConfig, b *batch, results map[string][]Finding) error {
+	var pieces []*batch
+	if s.config.RescanTruncated {
+		pieces = b.split(s.config.ChunkOverlapBytes)
+	}
+	if len(pieces) == 0 {
+		for _, e := range b.entries {
+			s.markTruncated(e.path)
+		}
+		return nil
+	}
+	for _, piece := range pieces {
+		reqCtx, cancel := s.requestContext(ctx)
+		found, truncated, err := s.inspectText(reqCtx, inspectConfig, piece.text.String())
+		expired := reqCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if err != nil && expired {
+			// The findings of the truncated request still stand
+			for _, e := range piece.entries {
+				s.markTruncated(e.path)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", piece.entries[0].path, err)
+		}
+		piece.addFindings(results, found)
+		if truncated {
+			if err := s.rescanTruncated(ctx, inspectConfig, piece, results); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dedupeFindings drops repeated findings of the same info type at the same
+// place, as the overlap of two windows reports them twice
+func dedupeFindings(findings []Finding) []Finding {
+	seen := make(map[string]bool)
+	kept := findings[:0]
+	for _, f := range findings {
+		key := fmt.Sprintf("%s %d %d %s", f.InfoType, f.Start, f.End, f.Template)
+		if !seen[key] {
+			seen[key] = true
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// scanBatched inspects contents under one inspect configuration,
+// concatenating small files into as few DLP requests as possible. Files that
+// exceed the request limit on their own are inspected individually, in
+// windows, in samples, or skipped, as Config.OversizedFiles says. Up to
+// Config.Concurrency requests run at once; the first failure cancels the
+// rest. A request that runs past Config.FileTimeoutSeconds is abandoned
+// without failing the scan. Findings are added to results by path, and the
+// reason a file was not inspected to skipped.
+func (s *Scanner) scanBatched(ctx context.Context, inspectConfig *dlppb.InspectConfig, contents []content, results map[string][]Finding, skipped map[string]string) error {
+	var batches []*batch
+	var chunked []string
+	current := &batch{}
+	for _, c := range contents {
+		if len(c.data) > maxRequestBytes {
+			switch s.config.OversizedFiles {
+			case OversizedSkip:
+				skipped[c.path] = SkippedOversized
+			case OversizedSample:
+				batches = append(batches, sample(c.path, c.data, s.config.Sampling)...)
+				chunked = append(chunked, c.path)
+			default:
+				batches = append(batches, chunk(c.path, c.data, s.config.ChunkOverlapBytes)...)
+				chunked = append(chunked, c.path)
+			}
+			continue
+		}
+		size := len(batchDelimiter(c.path)) + len(c.data)
+		if size > maxRequestBytes {
+			// Too large to share a request; fall back to a dedicated scan
+			batches = append(batches, single(c.path, c.data))
+			continue
+		}
+		if current.text.Len()+size > maxRequestBytes {
+			batches = append(batches, current)
+			current = &batch{}
+		}
+		current.add(c.path, c.data)
+	}
+	if len(current.entries) > 0 {
+		batches = append(batches, current)
+	}
+
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	findings := make([][]templateFinding, len(batches))
+	errs := make([]error, len(batches))
+	expired := make([]bool, len(batches))
+	truncated := make([]bool, len(batches))
+	sem := make(chan struct{}, s.config.Concurrency)
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Add(1)
+		go func(i int, b *batch) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := batchCtx.Err(); err != nil {
+				// Never inspected, so the batch must not pass as clean
+				errs[i] = err
+				return
+			}
+			reqCtx, reqCancel := s.requestContext(batchCtx)
+			defer reqCancel()
+			findings[i], truncated[i], errs[i] = s.inspectText(reqCtx, inspectConfig, b.text.String())
+			if errs[i] != nil && reqCtx.Err() == context.DeadlineExceeded && batchCtx.Err() == nil {
+				// Only this request ran out of time; let the others finish
+				expired[i] = true
+				errs[i] = nil
+				return
+			}
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, b)
+	}
+	wg.Wait()
+
+	// The first error other than a cancellation is the one reported, so the
+	// cause, such as an exhausted quota, is not hidden by the batches it
+	// cancelled
+	var cancelled error
+	for i, b := range batches {
+		if expired[i] {
+			for _, e := range b.entries {
+				skipped[e.path] = SkippedTimedOut
+			}
+			continue
+		}
+		if errs[i] != nil && ctx.Err() == nil && isCancellation(errs[i]) {
+			if cancelled == nil {
+				cancelled = errs[i]
+			}
+			continue
+		}
+		if errs[i] != nil {
+			if len(b.entries) == 1 {
+				return fmt.Errorf("%s: %w", b.entries[0].path, errs[i])
+			}
+			return errs[i]
+		}
+		b.addFindings(results, findings[i])
+		if truncated[i] {
+			if err := s.rescanTruncated(ctx, inspectConfig, b, results); err != nil {
+				return err
+			}
+			// The rescan finds again what the truncated request found
+			for _, e := range b.entries {
+				chunked = append(chunked, e.path)
+			}
+		}
+	}
+	if cancelled != nil {
+		// Nothing else failed, so the cancellation is the error
+		return cancelled
+	}
+	for _, path := range chunked {
+		results[path] = dedupeFindings(results[path])
+	}
+	// A chunked file is unscanned if any of its windows timed out
+	for path := range skipped {
+		delete(results, path)
+	}
+	return nil
+}
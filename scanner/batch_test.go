@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// quotaInspector fails a request with an exhausted quota while another,
+// holding slowText, is in flight. The slow request waits for its context
+// like a real call and ends with gRPC's Canceled status.
+type quotaInspector struct {
+	slowText string
+	started  chan struct{}
+}
+
+// InspectContent implements Inspector
+func (f *quotaInspector) InspectContent(ctx context.Context, req *dlppb.InspectContentRequest, opts ...gax.CallOption) (*dlppb.InspectContentResponse, error) {
+	if strings.Contains(req.GetItem().GetValue(), f.slowText) {
+		close(f.started)
+		<-ctx.Done()
+		return nil, status.Error(codes.Canceled, "context canceled")
+	}
+	<-f.started
+	return nil, status.Error(codes.ResourceExhausted, "quota exceeded")
+}
+
+func TestScanContentsReportsFailureOverCancellation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Cache.Entries = 0
+	s := New(&quotaInspector{slowText: "slow", started: make(chan struct{})}, cfg)
+
+	// Each file fills most of a request, so they go out as separate batches,
+	// the cancelled one first
+	filler := strings.Repeat("x", maxRequestBytes/2)
+	contents := []content{
+		{path: "slow.txt", data: []byte("slow\n" + filler)},
+		{path: "fast.txt", data: []byte("fast\n" + filler)},
+	}
+	_, _, err := s.scanContents(context.Background(), contents)
+	if !IsQuotaError(err) {
+		t.Fatalf("got error %v, want the quota error of the failed batch", err)
+	}
+}
+
+// benchmarkFile returns size bytes of source-like lines with a match of
+// testMatches every hundred lines
+func benchmarkFile(size int) []byte {
+	var data bytes.Buffer
+	for i := 0; data.Len() < size; i++ {
+		if i%100 == 0 {
+			fmt.Fprintf(&data, "\tcontact := %q // line %d\n", "alice@example.com", i)
+			continue
+		}
+		fmt.Fprintf(&data, "\tvalue%d := compute(%d, \"%s\")\n", i, i, strings.Repeat("a", i%40))
+	}
+	return data.Bytes()
+}
+
+// benchmarkContents runs scanContents over contents with a fakeInspector,
+// so it measures batching, mapping findings back and post-processing
+// rather than DLP
+func benchmarkContents(b *testing.B, contents []content) {
+	s, _ := newTestScanner(testMatches, nil)
+	var total int64
+	for _, c := range contents {
+		total += int64(len(c.data))
+	}
+	ctx := context.Background()
+	b.SetBytes(total)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := s.scanContents(ctx, contents); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanContentsSmallFiles(b *testing.B) {
+	var contents []content
+	for i := 0; i < 200; i++ {
+		contents = append(contents, content{path: fmt.Sprintf("pkg/file%d.go", i), data: benchmarkFile(4 * 1000)})
+	}
+	benchmarkContents(b, contents)
+}
+
+func BenchmarkScanContentsChunked(b *testing.B) {
+	benchmarkContents(b, []content{{path: "bundle.go", data: benchmarkFile(3 * maxRequestBytes)}})
+}
+
+func BenchmarkScanReader(b *testing.B) {
+	s, _ := newTestScanner(testMatches, nil)
+	data := benchmarkFile(maxRequestBytes / 2)
+	ctx := context.Background()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.ScanReader(ctx, "<stdin>", bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package scanner
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheConfig bounds the in-memory cache of inspection results
+type CacheConfig struct {
+	// Entries is the most results kept; 0 disables the cache
+	Entries int `json:"entries"`
+	// TTLSeconds is how long a result stays valid
+	TTLSeconds int `json:"ttlSeconds"`
+}
+
+// CacheStats counts lookups in the inspection cache
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+// cacheEntry is one cached inspection result
+type cacheEntry struct {
+	key      string
+	findings []Finding
+	// truncated is set when DLP truncated the findings, see TruncatedFiles
+	truncated bool
+	added     time.Time
+}
+
+// findingCache is a bounded LRU of findings keyed by a hash of the inspected
+// content, so identical payloads, such as a file scanned at its commit and
+// again in the final state, only cost one DLP request
+type findingCache struct {
+	mu      sync.Mutex
+	max     int
+	ttl     time.Duration
+	order   *list.List // most recently used at the front
+	entries map[string]*list.Element
+	stats   CacheStats
+}
+
+// newFindingCache returns a cache for cfg, or nil when caching is disabled
+func newFindingCache(cfg CacheConfig) *findingCache {
+	if cfg.Entries <= 0 {
+		return nil
+	}
+	return &findingCache{
+		max:     cfg.Entries,
+		ttl:     time.Duration(cfg.TTLSeconds) * time.Second,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// inspectConfigHash identifies the effective inspect configuration for path,
+// including the inspect templates applied with it and the regions inspected
+func (c *Config) inspectConfigHash(path string) string {
+	data, _ := json.Marshal(c.InspectConfigForPath(path))
+	h := sha256.New()
+	h.Write(data)
+	h.Write([]byte{0})
+	h.Write([]byte(c.ScanRegions))
+	for _, t := range c.InspectTemplates {
+		h.Write([]byte{0})
+		h.Write([]byte(t))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheKey identifies content by everything that affects its findings: the
+// hash of the inspect configuration applied, the extension deciding
+// structured flattening, and the data
+func cacheKey(configHash string, c content) string {
+	h := sha256.New()
+	h.Write([]byte(configHash))
+	h.Write([]byte{0})
+	h.Write([]byte(filepath.Ext(c.path)))
+	h.Write([]byte{0})
+	h.Write(c.data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns a copy of the cached findings for key and whether they were
+// truncated
+func (c *findingCache) get(key string) ([]Finding, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if ok && c.ttl > 0 && time.Since(elem.Value.(*cacheEntry).added) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	return append([]Finding(nil), entry.findings...), entry.truncated, true
+}
+
+// put stores findings under key, evicting the least recently used entry when full
+func (c *findingCache) put(key string, findings []Finding, truncated bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+	}
+	entry := &cacheEntry{key: key, findings: append([]Finding(nil), findings...), truncated: truncated, added: time.Now()}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// CacheStats returns the inspection cache hits and misses so far
+func (s *Scanner) CacheStats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	return s.cache.stats
+}
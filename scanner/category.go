@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Categories group info types for readers who do not know DLP's names
+const (
+	CategoryPII         = "PII"
+	CategoryFinancial   = "financial"
+	CategoryCredentials = "credentials"
+	CategoryHealth      = "health"
+	// CategoryOther holds info types with no known category
+	CategoryOther = "other"
+)
+
+// builtinCategories maps DLP info type names to their category. Config.Categories
+// adds to and overrides it.
+var builtinCategories = map[string]string{
+	"EMAIL_ADDRESS":             CategoryPII,
+	"PHONE_NUMBER":              CategoryPII,
+	"PERSON_NAME":               CategoryPII,
+	"STREET_ADDRESS":            CategoryPII,
+	"DATE_OF_BIRTH":             CategoryPII,
+	"IP_ADDRESS":                CategoryPII,
+	"PASSPORT":                  CategoryPII,
+	"US_SOCIAL_SECURITY_NUMBER": CategoryPII,
+	"US_PASSPORT":               CategoryPII,
+	"US_DRIVERS_LICENSE_NUMBER": CategoryPII,
+	"US_INDIVIDUAL_TAXPAYER_IDENTIFICATION_NUMBER": CategoryPII,
+	"US_ADOPTION_TAXPAYER_IDENTIFICATION_NUMBER":   CategoryPII,
+
+	"CREDIT_CARD_NUMBER":                CategoryFinancial,
+	"CREDIT_CARD_TRACK_NUMBER":          CategoryFinancial,
+	"FINANCIAL_ACCOUNT_NUMBER":          CategoryFinancial,
+	"IBAN_CODE":                         CategoryFinancial,
+	"SWIFT_CODE":                        CategoryFinancial,
+	"US_BANK_ROUTING_MICR":              CategoryFinancial,
+	"US_EMPLOYER_IDENTIFICATION_NUMBER": CategoryFinancial,
+
+	"AUTH_TOKEN":          CategoryCredentials,
+	"AWS_CREDENTIALS":     CategoryCredentials,
+	"AZURE_AUTH_TOKEN":    CategoryCredentials,
+	"ENCRYPTION_KEY":      CategoryCredentials,
+	"GCP_API_KEY":         CategoryCredentials,
+	"GCP_CREDENTIALS":     CategoryCredentials,
+	"HTTP_COOKIE":         CategoryCredentials,
+	"JSON_WEB_TOKEN":      CategoryCredentials,
+	"OAUTH_CLIENT_SECRET": CategoryCredentials,
+	"PASSWORD":            CategoryCredentials,
+	"XSRF_TOKEN":          CategoryCredentials,
+	HighEntropyInfoType:   CategoryCredentials,
+	PrivateKeyInfoType:    CategoryCredentials,
+
+	"FDA_CODE":                          CategoryHealth,
+	"ICD9_CODE":                         CategoryHealth,
+	"ICD10_CODE":                        CategoryHealth,
+	"MEDICAL_RECORD_NUMBER":             CategoryHealth,
+	"US_DEA_NUMBER":                     CategoryHealth,
+	"US_HEALTHCARE_NPI":                 CategoryHealth,
+	"US_MEDICARE_BENEFICIARY_ID_NUMBER": CategoryHealth,
+}
+
+// CategoryOf returns the category of an info type
+func (c *Config) CategoryOf(infoType string) string {
+	if category, ok := c.Categories[infoType]; ok {
+		return category
+	}
+	if category, ok := builtinCategories[infoType]; ok {
+		return category
+	}
+	return CategoryOther
+}
+
+// CategoryCounts returns the number of findings in each category
+func (r *Result) CategoryCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, f := range r.Files {
+		for _, finding := range f.Findings {
+			counts[finding.Category]++
+		}
+	}
+	return counts
+}
+
+// CategorySummary describes category counts in words, such as
+// "3 financial, 1 credentials", largest first
+func CategorySummary(counts map[string]int) string {
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if counts[categories[i]] != counts[categories[j]] {
+			return counts[categories[i]] > counts[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+	parts := make([]string, len(categories))
+	for i, category := range categories {
+		parts[i] = fmt.Sprintf("%d %s", counts[category], category)
+	}
+	return strings.Join(parts, ", ")
+}
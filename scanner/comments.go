@@ -0,0 +1,191 @@
+package scanner
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Regions name the parts of a source file, see Finding.Region and
+// Config.ScanRegions
+const (
+	RegionCode    = "code"
+	RegionComment = "comment"
+	// RegionAll stands for both, for Config.ScanRegions
+	RegionAll = "all"
+)
+
+// commentSyntax describes how a family of languages writes comments and the
+// string literals that can hide comment markers
+type commentSyntax struct {
+	line       []string
+	blockStart string
+	blockEnd   string
+	// quotes delimit strings that end at the line end; backquoted strings,
+	// when listed, span lines and have no escapes
+	quotes string
+}
+
+var (
+	cComments    = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`"}
+	rustComments = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\""}
+	phpComments  = commentSyntax{line: []string{"//", "#"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'"}
+	hashComments = commentSyntax{line: []string{"#"}, quotes: "\"'"}
+	tfComments   = commentSyntax{line: []string{"#", "//"}, blockStart: "/*", blockEnd: "*/", quotes: "\""}
+	sqlComments  = commentSyntax{line: []string{"--"}, blockStart: "/*", blockEnd: "*/", quotes: "'\""}
+	dashComments = commentSyntax{line: []string{"--"}, quotes: "'\""}
+)
+
+// commentSyntaxes maps file extensions, and the names of files without one,
+// to their comment syntax
+var commentSyntaxes = map[string]commentSyntax{
+	".go": cComments, ".c": cComments, ".h": cComments, ".cc": cComments,
+	".cpp": cComments, ".hpp": cComments, ".java": cComments, ".js": cComments,
+	".jsx": cComments, ".ts": cComments, ".tsx": cComments, ".cs": cComments,
+	".swift": cComments, ".kt": cComments, ".kts": cComments, ".scala": cComments,
+	".dart": cComments, ".rs": rustComments, ".php": phpComments,
+	".py": hashComments, ".rb": hashComments, ".sh": hashComments, ".bash": hashComments,
+	".zsh": hashComments, ".pl": hashComments, ".r": hashComments, ".ps1": hashComments,
+	".yaml": hashComments, ".yml": hashComments, ".toml": hashComments,
+	".tf": tfComments, ".sql": sqlComments, ".lua": dashComments, ".hs": dashComments,
+	"Dockerfile": hashComments, "Makefile": hashComments,
+}
+
+// commentSyntaxFor returns the comment syntax of the file at path, if known
+func commentSyntaxFor(path string) (commentSyntax, bool) {
+	if syntax, ok := commentSyntaxes[strings.ToLower(filepath.Ext(path))]; ok {
+		return syntax, true
+	}
+	syntax, ok := commentSyntaxes[filepath.Base(path)]
+	return syntax, ok
+}
+
+// commentSpans returns the byte ranges of the comments in data, in order.
+// The boolean is false for languages whose comments are not known. String
+// literals are skipped so markers inside them, as in URLs, are not taken for
+// comments; the lexing is deliberately simple and can be fooled by
+// constructs such as multi-line strings in quotes.
+func commentSpans(path string, data []byte) ([][2]int64, bool) {
+	syntax, ok := commentSyntaxFor(path)
+	if !ok {
+		return nil, false
+	}
+	var spans [][2]int64
+	for i := 0; i < len(data); {
+		rest := data[i:]
+		if syntax.blockStart != "" && bytes.HasPrefix(rest, []byte(syntax.blockStart)) {
+			end := bytes.Index(rest[len(syntax.blockStart):], []byte(syntax.blockEnd))
+			if end < 0 {
+				end = len(data)
+			} else {
+				end = i + len(syntax.blockStart) + end + len(syntax.blockEnd)
+			}
+			spans = append(spans, [2]int64{int64(i), int64(end)})
+			i = end
+			continue
+		}
+		if lineComment(data, i, syntax.line) {
+			end := bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(data)
+			} else {
+				end += i
+			}
+			spans = append(spans, [2]int64{int64(i), int64(end)})
+			i = end
+			continue
+		}
+		if q := data[i]; strings.IndexByte(syntax.quotes, q) >= 0 {
+			i = stringEnd(data, i, q)
+			continue
+		}
+		i++
+	}
+	return spans, true
+}
+
+// lineComment reports whether a line comment starts at data[i]. As in shell
+// and YAML, a "#" only starts one at the start of a line or after a space,
+// so it is not taken for a comment in URLs or "$#".
+func lineComment(data []byte, i int, markers []string) bool {
+	for _, marker := range markers {
+		if !bytes.HasPrefix(data[i:], []byte(marker)) {
+			continue
+		}
+		if marker != "#" || i == 0 || data[i-1] == ' ' || data[i-1] == '\t' || data[i-1] == '\n' {
+			return true
+		}
+	}
+	return false
+}
+
+// stringEnd returns the offset just past the string literal opened by the
+// quote at data[start]
+func stringEnd(data []byte, start int, quote byte) int {
+	for i := start + 1; i < len(data); i++ {
+		switch {
+		case data[i] == quote:
+			return i + 1
+		case quote == '`':
+			// Raw strings have no escapes and span lines
+		case data[i] == '\\':
+			i++
+		case data[i] == '\n':
+			return i
+		}
+	}
+	return len(data)
+}
+
+// regionAt returns RegionComment when offset falls in one of the sorted
+// comment spans, and RegionCode otherwise
+func regionAt(spans [][2]int64, offset int64) string {
+	i := sort.Search(len(spans), func(i int) bool { return spans[i][1] > offset })
+	if i < len(spans) && spans[i][0] <= offset {
+		return RegionComment
+	}
+	return RegionCode
+}
+
+// keepRegion returns a copy of data in which everything outside region,
+// RegionCode or RegionComment, is replaced by spaces. Newlines are kept, so
+// offsets, lines and columns of what remains are unchanged.
+func keepRegion(data []byte, spans [][2]int64, region string) []byte {
+	kept := make([]byte, len(data))
+	copy(kept, data)
+	blank := func(start, end int64) {
+		for i := start; i < end; i++ {
+			if kept[i] != '\n' {
+				kept[i] = ' '
+			}
+		}
+	}
+	if region == RegionCode {
+		for _, span := range spans {
+			blank(span[0], span[1])
+		}
+		return kept
+	}
+	var previous int64
+	for _, span := range spans {
+		blank(previous, span[0])
+		previous = span[1]
+	}
+	blank(previous, int64(len(kept)))
+	return kept
+}
+
+// markRegions sets the region of each finding in the content of path, when
+// the language's comments are known
+func markRegions(path string, data []byte, findings []Finding) {
+	spans, ok := commentSpans(path, data)
+	if !ok {
+		return
+	}
+	for i := range findings {
+		if !findings[i].InPath {
+			findings[i].Region = regionAt(spans, findings[i].Start)
+		}
+	}
+}
@@ -0,0 +1,645 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+)
+
+// DefaultConfigFile is loaded when present and no -config flag is given
+const DefaultConfigFile = ".dlpconfig.json"
+
+// RegexRule defines a custom info type matched by a regular expression
+type RegexRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	// Likelihood is reported for matches, such as VERY_LIKELY for a strict
+	// pattern; POSSIBLE when empty
+	Likelihood string `json:"likelihood,omitempty"`
+}
+
+// DictionaryRule defines a custom info type matched against a word list,
+// given either inline or as a GCS object with one phrase per line
+type DictionaryRule struct {
+	Name    string   `json:"name"`
+	Words   []string `json:"words,omitempty"`
+	GCSPath string   `json:"gcsPath,omitempty"`
+}
+
+// PathRule replaces the default info types for files matching any of its path globs
+type PathRule struct {
+	Name      string   `json:"name"`
+	Paths     []string `json:"paths"`
+	InfoTypes []string `json:"infoTypes"`
+}
+
+// MaskingRule is how redaction replaces findings of an info type, after
+// DLP's replace and character mask transformations: with Replacement when it
+// is set, and otherwise with MaskingCharacter repeated over the match,
+// leaving its last RevealLast characters visible. The rule is applied
+// locally rather than sent as a DeidentifyConfig, see Redact.
+type MaskingRule struct {
+	// Replacement is a fixed string, such as [REDACTED_EMAIL]
+	Replacement string `json:"replacement,omitempty"`
+	// MaskingCharacter is the single character masking the match, such as *
+	MaskingCharacter string `json:"maskingCharacter,omitempty"`
+	// RevealLast leaves this many trailing characters of the match unmasked
+	RevealLast int `json:"revealLast,omitempty"`
+}
+
+// Failure policies decide what happens to a git operation when DLP cannot be reached
+const (
+	// FailClosed blocks the operation, which is the default
+	FailClosed = "closed"
+	// FailOpen logs a warning and lets the operation proceed unscanned
+	FailOpen = "open"
+)
+
+// Dirty file policies decide how a push scan reads the final state of files
+// with uncommitted changes
+const (
+	// DirtyWarn scans the working-tree file and marks it as differing from
+	// the commit, which is the default
+	DirtyWarn = "warn"
+	// DirtyCommitted scans the content the pushed commit holds instead
+	DirtyCommitted = "committed"
+)
+
+// Filter policies decide what git filter mode does with content that has
+// blocking findings; it exits non-zero either way
+const (
+	// FilterBlock writes nothing back to git, which is the default
+	FilterBlock = "block"
+	// FilterPass writes the content back unchanged
+	FilterPass = "pass"
+)
+
+// Oversized file policies decide how files larger than one DLP request are handled
+const (
+	// OversizedChunk inspects the file in request-sized windows, which is the default
+	OversizedChunk = "chunk"
+	// OversizedSkip reports the file as skipped without inspecting it
+	OversizedSkip = "skip"
+	// OversizedSample inspects only the parts Config.Sampling chooses and
+	// marks the file as sampled, not exhaustive
+	OversizedSample = "sample"
+)
+
+// Actions decide how a finding is handled, see Config.Actions
+const (
+	// ActionBlock fails the operation, which is the default
+	ActionBlock = "block"
+	// ActionWarn reports the finding without failing the operation
+	ActionWarn = "warn"
+	// ActionRedact fails a push like ActionBlock, since the data is in the
+	// commits, and also redacts the finding in the working tree so the fix
+	// only needs an amend
+	ActionRedact = "redact"
+)
+
+// DefaultParent is the parent resource template used when none is configured
+const DefaultParent = "projects/{project}/locations/global"
+
+// parentPattern matches the parent resource names DLP accepts
+var parentPattern = regexp.MustCompile(`^(projects|organizations)/[^/{}]+(/locations/[^/{}]+)?$`)
+
+// maxFindingsLimit is the largest MaxFindingsPerRequest DLP accepts for
+// content inspection
+const maxFindingsLimit = 2000
+
+// commitPrefix matches an abbreviated or full commit SHA
+var commitPrefix = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+
+// DefaultRuleSet names the info type set used when no path rule matches
+const DefaultRuleSet = "default"
+
+// Config holds the scan policy
+type Config struct {
+	ProjectID string `json:"projectId"`
+	// Parent is the template of the parent resource for DLP requests, in
+	// which {project} stands for ProjectID
+	Parent    string   `json:"parent"`
+	InfoTypes []string `json:"infoTypes"`
+	// ExcludeInfoTypes drops findings of these info types before the block
+	// decision, to quiet a noisy type without narrowing detection elsewhere
+	ExcludeInfoTypes []string `json:"excludeInfoTypes"`
+	// InspectTemplates are full inspect template names applied on top of
+	// the local info types, each in a request of its own
+	InspectTemplates []string `json:"inspectTemplates"`
+	// FailOn, when set, limits the info types that block; findings of other
+	// types are still reported
+	FailOn       []string         `json:"failOn"`
+	Regexes      []RegexRule      `json:"regexes"`
+	Dictionaries []DictionaryRule `json:"dictionaries"`
+	// PathRules are checked in order; the first rule matching a file wins
+	PathRules []PathRule `json:"pathRules"`
+	// FailurePolicy is FailClosed or FailOpen
+	FailurePolicy string `json:"failurePolicy"`
+	// ScanWhitespaceOnly disables skipping files a commit only reformats
+	ScanWhitespaceOnly bool `json:"scanWhitespaceOnly"`
+	// BlockOnContext blocks on findings in lines a commit or push did not
+	// add, as on added lines; by default they only warn, so edits near
+	// existing data are not blamed for it
+	BlockOnContext bool `json:"blockOnContext"`
+	// Include, when set, limits scanning to files matching any of these globs
+	Include []string `json:"include"`
+	// ScanPaths also inspects the path of every scanned file, for sensitive
+	// data in file and directory names, reported as path findings
+	ScanPaths bool `json:"scanPaths"`
+	// IncludeQuote has findings carry the matched text. It is off by default
+	// so sensitive substrings are not returned by DLP or printed.
+	IncludeQuote bool `json:"includeQuote"`
+	// Entropy configures the local detector for random-looking secrets
+	Entropy EntropyConfig `json:"entropy"`
+	// Concurrency is the maximum number of DLP requests in flight at once
+	Concurrency int `json:"concurrency"`
+	// FileTimeoutSeconds bounds each DLP request, so one slow file is marked
+	// as timed out instead of stalling the scan; 0 disables the limit
+	FileTimeoutSeconds int `json:"fileTimeoutSeconds"`
+	// RetryBudget is the total number of retries of transient DLP failures
+	// allowed across the whole scan; once spent, failures are not retried
+	RetryBudget int `json:"retryBudget"`
+	// ScanRegions is RegionAll, or RegionCode or RegionComment to inspect
+	// only the code or only the comments of source files in languages whose
+	// comment syntax is known; other files are inspected whole. Content
+	// streamed in windows is always inspected whole.
+	ScanRegions string `json:"scanRegions"`
+	// FilterFindings is FilterBlock or FilterPass
+	FilterFindings string `json:"filterFindings"`
+	// DirtyFiles is DirtyWarn or DirtyCommitted
+	DirtyFiles string `json:"dirtyFiles"`
+	// OversizedFiles is OversizedChunk, OversizedSkip or OversizedSample
+	OversizedFiles string `json:"oversizedFiles"`
+	// Sampling chooses what is inspected of files under OversizedSample
+	Sampling SamplingConfig `json:"sampling"`
+	// MaxFindingsPerRequest caps the findings DLP returns for one request,
+	// which may cover several small files; a few findings are enough to
+	// block. Requests that hit the cap are counted, see
+	// Scanner.TruncatedRequests. 0 leaves DLP's own limit.
+	MaxFindingsPerRequest int `json:"maxFindingsPerRequest"`
+	// RescanTruncated inspects the content of requests whose findings DLP
+	// truncated again in smaller pieces, so fewer findings are left out;
+	// see Scanner.TruncatedFiles for those that may still be
+	RescanTruncated bool `json:"rescanTruncated"`
+	// ChunkOverlapBytes is how much consecutive windows of a chunked file
+	// share. A match split across a window boundary is only found if it is
+	// shorter than the overlap, but every overlapping byte is inspected,
+	// and billed, twice.
+	ChunkOverlapBytes int `json:"chunkOverlapBytes"`
+	// CumulativeDiff makes a push scan inspect only the lines added by the
+	// cumulative diff from the upstream branch, instead of every commit
+	CumulativeDiff bool `json:"cumulativeDiff"`
+	// BaseRef is the branch a -merge-base scan compares HEAD with, such as
+	// origin/main; empty means the upstream branch
+	BaseRef string `json:"baseRef"`
+	// ProtectedBranches are patterns, such as main or release/*, of the
+	// remote branches whose pushes are scanned; pushes to other branches go
+	// through unscanned. Empty scans pushes to every branch.
+	ProtectedBranches []string `json:"protectedBranches"`
+	// AllowedCommits are commit SHAs, or prefixes of at least 7 characters,
+	// that ScanCommit skips entirely, for known-clean history or commits that
+	// cannot be rewritten. Unlike ExcludeInfoTypes, nothing in them is scanned.
+	AllowedCommits []string `json:"allowedCommits"`
+	// AllowedCommitsFile names a file listing more allowed commits, one per
+	// line; blank lines and lines starting with # are ignored
+	AllowedCommitsFile string `json:"allowedCommitsFile"`
+	// FailFast stops scanning at the first commit with sensitive data instead
+	// of reporting every flagged file in one pass
+	FailFast bool `json:"failFast"`
+	// Strict treats anything left unscanned as a block: skipped files,
+	// warnings, and DLP being unreachable, which forces FailClosed
+	Strict bool `json:"strict"`
+	// AccumulateErrors records git and file read failures in Result.Errors and
+	// scans the remaining content, instead of aborting on the first one
+	AccumulateErrors bool `json:"accumulateErrors"`
+	// Categories maps info type names to report categories, adding to and
+	// overriding the built-in mapping
+	Categories map[string]string `json:"categories"`
+	// Actions maps info type names or categories to ActionBlock, ActionWarn
+	// or ActionRedact. An info type's own entry wins over its category's;
+	// findings with neither are blocked.
+	Actions map[string]string `json:"actions"`
+	// RiskWeights maps categories to the risk score a finding adds at the
+	// highest likelihood, adding to and overriding the defaults
+	RiskWeights map[string]float64 `json:"riskWeights"`
+	// LikelihoodThresholds maps info type names to the lowest likelihood,
+	// such as POSSIBLE or VERY_LIKELY, at which their findings block. They
+	// are sent to DLP as per-type minimums, so it does not return findings
+	// below them; findings below them from local detectors and inspect
+	// templates are reported as informational
+	LikelihoodThresholds map[string]string `json:"likelihoodThresholds"`
+	// Masking maps info type names to how redaction replaces their findings;
+	// without an entry a finding is replaced by its info type in brackets
+	Masking map[string]MaskingRule `json:"masking"`
+	// Cache bounds the in-memory cache of inspection results
+	Cache CacheConfig `json:"cache"`
+}
+
+// DefaultConfig returns the policy used when no config file is present
+func DefaultConfig() *Config {
+	return &Config{
+		ProjectID:     "datalake-sea-eng-us-cert",
+		Parent:        DefaultParent,
+		FailurePolicy: FailClosed,
+		Concurrency:   4,
+
+		FileTimeoutSeconds: 60,
+		OversizedFiles:     OversizedChunk,
+		DirtyFiles:         DirtyWarn,
+		FilterFindings:     FilterBlock,
+		ScanRegions:        RegionAll,
+		ChunkOverlapBytes:  256,
+		RetryBudget:        20,
+
+		MaxFindingsPerRequest: 100,
+		Sampling: SamplingConfig{
+			HeadBytes:   64 * 1000,
+			TailBytes:   64 * 1000,
+			Windows:     4,
+			WindowBytes: 64 * 1000,
+		},
+		Cache: CacheConfig{
+			Entries:    1000,
+			TTLSeconds: 3600,
+		},
+		Entropy: EntropyConfig{
+			Threshold: 4.5,
+			MinLength: 20,
+		},
+		InfoTypes: []string{"EMAIL_ADDRESS", "PHONE_NUMBER", "US_SOCIAL_SECURITY_NUMBER"},
+		Regexes: []RegexRule{
+			{Name: "RampID", Pattern: "XY[0-9]{4}.*"},
+		},
+	}
+}
+
+// LoadConfig reads a JSON config file on top of the defaults. A missing
+// file is only an error when it was requested explicitly.
+func LoadConfig(path string, explicit bool) (*Config, error) {
+	cfg := DefaultConfig()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return cfg, nil
+		}
+		return nil, &ConfigError{Op: fmt.Sprintf("could not read config %s", path), Err: err}
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, &ConfigError{Op: fmt.Sprintf("could not parse config %s", path), Err: err}
+	}
+	if cfg.AllowedCommitsFile != "" {
+		allowed, err := readAllowedCommits(cfg.AllowedCommitsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.AllowedCommits = append(cfg.AllowedCommits, allowed...)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, &ConfigError{Op: fmt.Sprintf("invalid config %s", path), Err: err}
+	}
+	return cfg, nil
+}
+
+// readAllowedCommits reads the commit SHAs listed in an AllowedCommitsFile
+func readAllowedCommits(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &ConfigError{Op: fmt.Sprintf("could not read allowed commits %s", path), Err: err}
+	}
+	var commits []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// Protected reports whether pushes to branch are scanned under ProtectedBranches
+func (c *Config) Protected(branch string) bool {
+	if len(c.ProtectedBranches) == 0 {
+		return true
+	}
+	for _, pattern := range c.ProtectedBranches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CommitAllowed reports whether commit is listed in AllowedCommits
+func (c *Config) CommitAllowed(commit string) bool {
+	for _, allowed := range c.AllowedCommits {
+		if strings.HasPrefix(commit, strings.ToLower(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Excluded reports whether findings of infoType are dropped by ExcludeInfoTypes
+func (c *Config) Excluded(infoType string) bool {
+	for _, name := range c.ExcludeInfoTypes {
+		if name == infoType {
+			return true
+		}
+	}
+	return false
+}
+
+// likelihoodNamed returns the likelihood with the given name, such as
+// POSSIBLE, and whether the name is one findings can have
+func likelihoodNamed(name string) (dlppb.Likelihood, bool) {
+	value, ok := dlppb.Likelihood_value[name]
+	return dlppb.Likelihood(value), ok && value != 0
+}
+
+// likelihoodNames lists the valid likelihood names for error messages
+const likelihoodNames = "VERY_UNLIKELY, UNLIKELY, POSSIBLE, LIKELY or VERY_LIKELY"
+
+// Informational reports whether a finding of infoType with the given
+// likelihood is below the type's threshold in LikelihoodThresholds
+func (c *Config) Informational(infoType string, likelihood dlppb.Likelihood) bool {
+	threshold, ok := c.LikelihoodThresholds[infoType]
+	if !ok {
+		return false
+	}
+	min, _ := likelihoodNamed(threshold)
+	return likelihood < min
+}
+
+// ActionFor returns the action for findings of infoType under Actions
+func (c *Config) ActionFor(infoType string) string {
+	if action, ok := c.Actions[infoType]; ok {
+		return action
+	}
+	if action, ok := c.Actions[c.CategoryOf(infoType)]; ok {
+		return action
+	}
+	return ActionBlock
+}
+
+// ParentPath returns the parent resource name for DLP requests
+func (c *Config) ParentPath() string {
+	return strings.ReplaceAll(c.Parent, "{project}", c.ProjectID)
+}
+
+// Validate checks the config for missing or conflicting settings, returning
+// a *ConfigError
+func (c *Config) Validate() error {
+	if err := c.validate(); err != nil {
+		return &ConfigError{Err: err}
+	}
+	return nil
+}
+
+// validate does the checks of Validate
+func (c *Config) validate() error {
+	if c.ProjectID == "" && strings.Contains(c.Parent, "{project}") {
+		return fmt.Errorf("projectId is required")
+	}
+	if !parentPattern.MatchString(c.ParentPath()) {
+		return fmt.Errorf("parent %q must expand to projects/<id> or organizations/<id>, optionally followed by /locations/<location>", c.Parent)
+	}
+	if c.FailurePolicy != FailClosed && c.FailurePolicy != FailOpen {
+		return fmt.Errorf("failurePolicy must be %q or %q", FailClosed, FailOpen)
+	}
+	for _, r := range c.Regexes {
+		if r.Name == "" || r.Pattern == "" {
+			return fmt.Errorf("regex rules need both name and pattern")
+		}
+		if _, ok := likelihoodNamed(r.Likelihood); r.Likelihood != "" && !ok {
+			return fmt.Errorf("regex %s likelihood %q must be one of %s", r.Name, r.Likelihood, likelihoodNames)
+		}
+	}
+	for _, d := range c.Dictionaries {
+		if d.Name == "" {
+			return fmt.Errorf("dictionary rules need a name")
+		}
+		if (len(d.Words) > 0) == (d.GCSPath != "") {
+			return fmt.Errorf("dictionary %s must set exactly one of words or gcsPath", d.Name)
+		}
+		if d.GCSPath != "" && !strings.HasPrefix(d.GCSPath, "gs://") {
+			return fmt.Errorf("dictionary %s gcsPath must start with gs://", d.Name)
+		}
+	}
+	for _, pattern := range c.ProtectedBranches {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("malformed protected branch pattern %q", pattern)
+		}
+	}
+	for _, commit := range c.AllowedCommits {
+		if !commitPrefix.MatchString(commit) {
+			return fmt.Errorf("allowed commit %q must be a hex SHA of at least 7 characters", commit)
+		}
+	}
+	if c.MaxFindingsPerRequest < 0 || c.MaxFindingsPerRequest > maxFindingsLimit {
+		return fmt.Errorf("maxFindingsPerRequest must be between 0 and %d", maxFindingsLimit)
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	for _, t := range c.InspectTemplates {
+		if !strings.Contains(t, "/inspectTemplates/") {
+			return fmt.Errorf("inspect template %q must be a full name such as projects/<id>/inspectTemplates/<name>", t)
+		}
+	}
+	for name, threshold := range c.LikelihoodThresholds {
+		if _, ok := likelihoodNamed(threshold); !ok {
+			return fmt.Errorf("likelihood threshold %q for %s must be one of %s", threshold, name, likelihoodNames)
+		}
+	}
+	for name, action := range c.Actions {
+		if action != ActionBlock && action != ActionWarn && action != ActionRedact {
+			return fmt.Errorf("action for %s must be %q, %q or %q", name, ActionBlock, ActionWarn, ActionRedact)
+		}
+	}
+	for name, rule := range c.Masking {
+		if (rule.Replacement == "") == (rule.MaskingCharacter == "") {
+			return fmt.Errorf("masking for %s must set exactly one of replacement or maskingCharacter", name)
+		}
+		if rule.MaskingCharacter != "" && utf8.RuneCountInString(rule.MaskingCharacter) != 1 {
+			return fmt.Errorf("masking character for %s must be a single character", name)
+		}
+		if rule.RevealLast < 0 || rule.RevealLast > 0 && rule.MaskingCharacter == "" {
+			return fmt.Errorf("revealLast for %s must not be negative and needs a maskingCharacter", name)
+		}
+	}
+	for category, weight := range c.RiskWeights {
+		if weight < 0 {
+			return fmt.Errorf("risk weight for %s must not be negative", category)
+		}
+	}
+	if c.OversizedFiles != OversizedChunk && c.OversizedFiles != OversizedSkip && c.OversizedFiles != OversizedSample {
+		return fmt.Errorf("oversizedFiles must be %q, %q or %q", OversizedChunk, OversizedSkip, OversizedSample)
+	}
+	if c.ScanRegions != RegionAll && c.ScanRegions != RegionCode && c.ScanRegions != RegionComment {
+		return fmt.Errorf("scanRegions must be %q, %q or %q", RegionAll, RegionCode, RegionComment)
+	}
+	if c.FilterFindings != FilterBlock && c.FilterFindings != FilterPass {
+		return fmt.Errorf("filterFindings must be %q or %q", FilterBlock, FilterPass)
+	}
+	if c.DirtyFiles != DirtyWarn && c.DirtyFiles != DirtyCommitted {
+		return fmt.Errorf("dirtyFiles must be %q or %q", DirtyWarn, DirtyCommitted)
+	}
+	if err := c.Sampling.validate(); err != nil {
+		return err
+	}
+	if c.ChunkOverlapBytes < 0 || c.ChunkOverlapBytes >= maxRequestBytes/2 {
+		return fmt.Errorf("chunkOverlapBytes must be between 0 and %d", maxRequestBytes/2-1)
+	}
+	if c.Cache.Entries < 0 || c.Cache.TTLSeconds < 0 {
+		return fmt.Errorf("cache entries and ttlSeconds must not be negative")
+	}
+	if c.RetryBudget < 0 {
+		return fmt.Errorf("retryBudget must not be negative")
+	}
+	if c.FileTimeoutSeconds < 0 {
+		return fmt.Errorf("fileTimeoutSeconds must not be negative")
+	}
+	if c.Entropy.Enabled && (c.Entropy.Threshold <= 0 || c.Entropy.MinLength <= 0) {
+		return fmt.Errorf("entropy threshold and minLength must be positive")
+	}
+	for _, p := range c.Include {
+		if !validGlob(p) {
+			return fmt.Errorf("malformed include glob %q", p)
+		}
+	}
+	for _, r := range c.PathRules {
+		if r.Name == "" || r.Name == DefaultRuleSet {
+			return fmt.Errorf("path rules need a name other than %q", DefaultRuleSet)
+		}
+		if len(r.Paths) == 0 || len(r.InfoTypes) == 0 {
+			return fmt.Errorf("path rule %s needs both paths and infoTypes", r.Name)
+		}
+		for _, p := range r.Paths {
+			if !validGlob(p) {
+				return fmt.Errorf("path rule %s has malformed glob %q", r.Name, p)
+			}
+		}
+	}
+	return nil
+}
+
+// Included reports whether path is in scope under the include globs
+func (c *Config) Included(path string) bool {
+	return len(c.Include) == 0 || matchAny(c.Include, path)
+}
+
+// RuleSetFor returns the name of the info type set that applies to path
+func (c *Config) RuleSetFor(path string) string {
+	if rule := c.pathRuleFor(path); rule != nil {
+		return rule.Name
+	}
+	return DefaultRuleSet
+}
+
+// pathRuleFor returns the first path rule matching path, or nil
+func (c *Config) pathRuleFor(path string) *PathRule {
+	for i := range c.PathRules {
+		if matchAny(c.PathRules[i].Paths, path) {
+			return &c.PathRules[i]
+		}
+	}
+	return nil
+}
+
+// InspectConfig builds the DLP inspect configuration for this policy
+func (c *Config) InspectConfig() *dlppb.InspectConfig {
+	return c.inspectConfigWith(c.InfoTypes)
+}
+
+// InspectConfigForPath builds the DLP inspect configuration for a file,
+// using the info types of the path rule that matches it
+func (c *Config) InspectConfigForPath(path string) *dlppb.InspectConfig {
+	if rule := c.pathRuleFor(path); rule != nil {
+		return c.inspectConfigWith(rule.InfoTypes)
+	}
+	return c.InspectConfig()
+}
+
+// inspectConfigWith builds the DLP inspect configuration for the given
+// built-in info types plus the configured custom info types
+func (c *Config) inspectConfigWith(infoTypes []string) *dlppb.InspectConfig {
+	inspectConfig := &dlppb.InspectConfig{IncludeQuote: c.IncludeQuote}
+	if c.MaxFindingsPerRequest > 0 {
+		inspectConfig.Limits = &dlppb.InspectConfig_FindingLimits{MaxFindingsPerRequest: int32(c.MaxFindingsPerRequest)}
+	}
+
+	for _, name := range infoTypes {
+		inspectConfig.InfoTypes = append(inspectConfig.InfoTypes, &dlppb.InfoType{Name: name})
+	}
+
+	for _, r := range c.Regexes {
+		likelihood, ok := likelihoodNamed(r.Likelihood)
+		if !ok {
+			likelihood = dlppb.Likelihood_POSSIBLE
+		}
+		inspectConfig.CustomInfoTypes = append(inspectConfig.CustomInfoTypes, &dlppb.CustomInfoType{
+			InfoType: &dlppb.InfoType{Name: r.Name},
+			Type: &dlppb.CustomInfoType_Regex_{Regex: &dlppb.CustomInfoType_Regex{
+				Pattern: r.Pattern,
+			}},
+			Likelihood: likelihood,
+		})
+	}
+
+	for _, d := range c.Dictionaries {
+		dictionary := &dlppb.CustomInfoType_Dictionary{}
+		if d.GCSPath != "" {
+			dictionary.Source = &dlppb.CustomInfoType_Dictionary_CloudStoragePath{
+				CloudStoragePath: &dlppb.CloudStoragePath{Path: d.GCSPath},
+			}
+		} else {
+			dictionary.Source = &dlppb.CustomInfoType_Dictionary_WordList_{
+				WordList: &dlppb.CustomInfoType_Dictionary_WordList{Words: d.Words},
+			}
+		}
+		inspectConfig.CustomInfoTypes = append(inspectConfig.CustomInfoTypes, &dlppb.CustomInfoType{
+			InfoType:   &dlppb.InfoType{Name: d.Name},
+			Type:       &dlppb.CustomInfoType_Dictionary_{Dictionary: dictionary},
+			Likelihood: dlppb.Likelihood_POSSIBLE,
+		})
+	}
+
+	inspectConfig.MinLikelihoodPerInfoType = c.minLikelihoods(inspectConfig)
+	return inspectConfig
+}
+
+// minLikelihoods returns the LikelihoodThresholds of the info types
+// inspectConfig requests, sorted by name so the configuration, and with it
+// the cache key, is stable
+func (c *Config) minLikelihoods(inspectConfig *dlppb.InspectConfig) []*dlppb.InspectConfig_InfoTypeLikelihood {
+	var names []string
+	for _, t := range inspectConfig.InfoTypes {
+		names = append(names, t.Name)
+	}
+	for _, t := range inspectConfig.CustomInfoTypes {
+		names = append(names, t.InfoType.Name)
+	}
+	sort.Strings(names)
+	var mins []*dlppb.InspectConfig_InfoTypeLikelihood
+	for i, name := range names {
+		threshold, ok := c.LikelihoodThresholds[name]
+		if !ok || i > 0 && names[i-1] == name {
+			continue
+		}
+		min, _ := likelihoodNamed(threshold)
+		mins = append(mins, &dlppb.InspectConfig_InfoTypeLikelihood{
+			InfoType:      &dlppb.InfoType{Name: name},
+			MinLikelihood: min,
+		})
+	}
+	return mins
+}
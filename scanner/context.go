@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// addedLineSet returns, per file, the line numbers of the new version that
+// the zero-context diff git prints for args adds. LFS pointers are left out,
+// since their findings are in the resolved content, not the pointer lines.
+func addedLineSet(dir string, args ...string) (map[string]map[int]bool, error) {
+	args = append([]string{"-c", "core.quotePath=false"}, args...)
+	output, err := gitCommand(dir, args...).Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to list added lines with git %v", args[2:]), Err: err}
+	}
+	added := make(map[string]map[int]bool)
+	for _, f := range parseAddedLines(string(output)) {
+		if _, isPointer := parseLFSPointer(f.text.Bytes()); isPointer {
+			continue
+		}
+		lines := make(map[int]bool)
+		for _, line := range f.lines {
+			lines[line] = true
+		}
+		added[f.path] = lines
+	}
+	return added, nil
+}
+
+// commitAddedLines returns the lines a commit of the repository at dir adds,
+// per file. Merge commits show no diff, so none of their files are listed.
+func commitAddedLines(dir, commit string) (map[string]map[int]bool, error) {
+	return addedLineSet(dir, "diff-tree", "-p", "-U0", "--no-color", "--no-ext-diff", "--root", "--no-commit-id", "-r", commit)
+}
+
+// pushAddedLines returns the lines the working tree, or the last of commits
+// when committed is set, adds to the parent of the first of commits, per
+// file: everything a push of them brings in
+func pushAddedLines(commits []string, committed bool) (map[string]map[int]bool, error) {
+	base := emptyTree
+	if exec.Command("git", "rev-parse", "--verify", "--quiet", commits[0]+"^").Run() == nil {
+		base = commits[0] + "^"
+	}
+	args := []string{"diff", "-U0", "--no-color", "--no-ext-diff", "--ignore-submodules", base}
+	if committed {
+		args = append(args, commits[len(commits)-1])
+	}
+	return addedLineSet("", append(args, "--")...)
+}
+
+// markContext flags the findings of result's files on lines that added does
+// not list for them: pre-existing content of a file that was only edited
+// near. Unless Config.BlockOnContext is set they only warn. Paths in result
+// are relative to dir, and files missing from added are left alone.
+func (s *Scanner) markContext(result *Result, dir string, added map[string]map[int]bool) {
+	for i, f := range result.Files {
+		rel := f.Path
+		if dir != "" {
+			rel = strings.TrimPrefix(f.Path, dir+string(filepath.Separator))
+		}
+		lines, ok := added[filepath.ToSlash(rel)]
+		if !ok {
+			continue
+		}
+		for j, finding := range f.Findings {
+			if finding.InPath || finding.Line == 0 || lines[finding.Line] {
+				continue
+			}
+			finding.Context = true
+			if !s.config.BlockOnContext {
+				finding.Action = ActionWarn
+			}
+			result.Files[i].Findings[j] = finding
+		}
+	}
+}
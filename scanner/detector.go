@@ -0,0 +1,21 @@
+package scanner
+
+// Detector finds sensitive data in file content without calling DLP. Every
+// detector registered on a Scanner runs on each text file alongside DLP, and
+// its findings are merged with DLP's before exclusion and the block decision.
+type Detector interface {
+	// Detect returns the findings in content, with Start and End as byte
+	// offsets into it
+	Detect(content []byte) []Finding
+}
+
+// EntropyDetector reports random-looking tokens, see EntropyConfig
+type EntropyDetector struct {
+	Threshold float64
+	MinLength int
+}
+
+// Detect returns a HighEntropyInfoType finding for each qualifying token
+func (d EntropyDetector) Detect(content []byte) []Finding {
+	return findHighEntropy(content, d.Threshold, d.MinLength)
+}
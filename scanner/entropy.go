@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"math"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+)
+
+// HighEntropyInfoType is the info type reported for random-looking tokens
+const HighEntropyInfoType = "HIGH_ENTROPY_STRING"
+
+// EntropyConfig controls the local high-entropy token detector
+type EntropyConfig struct {
+	Enabled bool `json:"enabled"`
+	// Threshold is the minimum Shannon entropy in bits per character
+	Threshold float64 `json:"threshold"`
+	// MinLength is the shortest token considered
+	MinLength int `json:"minLength"`
+}
+
+// isTokenByte reports whether b can be part of a secret-like token
+func isTokenByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' ||
+		b == '+' || b == '/' || b == '=' || b == '_' || b == '-'
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	entropy := 0.0
+	n := float64(len(s))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// findHighEntropy returns a finding for every token in data at least
+// minLength long whose entropy reaches threshold
+func findHighEntropy(data []byte, threshold float64, minLength int) []Finding {
+	var findings []Finding
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && isTokenByte(data[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minLength {
+			token := string(data[start:i])
+			if shannonEntropy(token) >= threshold {
+				findings = append(findings, Finding{
+					InfoType:   HighEntropyInfoType,
+					Likelihood: dlppb.Likelihood_POSSIBLE,
+					Quote:      token,
+					Start:      int64(start),
+					End:        int64(i),
+				})
+			}
+		}
+		start = -1
+	}
+	return findings
+}
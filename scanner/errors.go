@@ -0,0 +1,50 @@
+package scanner
+
+// The error types below let callers tell the source of a failure apart with
+// errors.As. Each wraps the underlying error, when there is one, so errors.Is
+// and status.Code still see it.
+
+// GitError is a failure running or reading from git
+type GitError struct {
+	// Op describes what failed, such as "failed to resolve HEAD"
+	Op  string
+	Err error
+}
+
+func (e *GitError) Error() string { return joinError(e.Op, e.Err) }
+
+func (e *GitError) Unwrap() error { return e.Err }
+
+// DLPError is a failure of a DLP API call, or a response that could not be used
+type DLPError struct {
+	// Op describes what failed, such as "failed to inspect content"
+	Op  string
+	Err error
+}
+
+func (e *DLPError) Error() string { return joinError(e.Op, e.Err) }
+
+func (e *DLPError) Unwrap() error { return e.Err }
+
+// ConfigError is a config or credentials file that could not be read, parsed
+// or validated
+type ConfigError struct {
+	// Op describes what failed, such as "invalid config .dlp.json"
+	Op  string
+	Err error
+}
+
+func (e *ConfigError) Error() string { return joinError(e.Op, e.Err) }
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// joinError formats op followed by err, either of which may be empty
+func joinError(op string, err error) string {
+	switch {
+	case err == nil:
+		return op
+	case op == "":
+		return err.Error()
+	}
+	return op + ": " + err.Error()
+}
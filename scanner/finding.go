@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+)
+
+// Finding is one piece of sensitive data located in a scanned file
+type Finding struct {
+	InfoType   string
+	Likelihood dlppb.Likelihood
+	// Quote is the matched text, when Config.IncludeQuote is set
+	Quote string
+	// Start and End are byte offsets of the match within the file content
+	Start int64
+	End   int64
+	// Field is the key path of the value holding the match in JSON and YAML files
+	Field string
+	// Category groups the info type for summaries, see Config.CategoryOf
+	Category string
+	// Line and Column locate Start in the file, both 1-based with the column
+	// counted in characters; 0 when the offsets do not map into the text, as
+	// for documents DLP parsed itself
+	Line   int
+	Column int
+	// Template is the inspect template that produced the finding, empty for
+	// the local configuration and local detectors
+	Template string
+	// BoundingBoxes locate the match in an image inspected with OCR
+	BoundingBoxes []BoundingBox
+	// Action is how the finding is handled, from Config.ActionFor
+	Action string
+	// Informational is set when the likelihood is below the info type's
+	// threshold in Config.LikelihoodThresholds; such findings do not block
+	Informational bool
+	// InPath is set for a match in the file's path rather than its content,
+	// see Config.ScanPaths; Start and End are then offsets into the path
+	InPath bool
+	// Context is set for a match on a line the scanned change did not add,
+	// content that was already there; see Config.BlockOnContext
+	Context bool
+	// Fingerprint identifies the finding across runs, see setFingerprint
+	Fingerprint string
+	// Region is RegionCode or RegionComment in source files whose comment
+	// syntax is known, and empty elsewhere
+	Region string
+}
+
+// Blocks reports whether the finding blocks under failOn, as Result.Blocks
+// counts it
+func (f Finding) Blocks(failOn []string) bool {
+	return !f.Informational && f.Action != ActionWarn && blocksOn(failOn, f.InfoType)
+}
+
+// BoundingBox is a rectangle in an image, in pixels from its top left corner
+type BoundingBox struct {
+	Top    int32 `json:"top"`
+	Left   int32 `json:"left"`
+	Width  int32 `json:"width"`
+	Height int32 `json:"height"`
+}
+
+// lineColumn returns the 1-based line and character column of offset in data
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset < 0 || offset > int64(len(data)) {
+		return 0, 0
+	}
+	before := data[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return bytes.Count(before, []byte{'\n'}) + 1, utf8.RuneCount(before[lineStart:]) + 1
+}
+
+// setFingerprint sets the fingerprint of a finding in the content of path:
+// the first 16 bytes, in hex, of the SHA-256 of the path, the info type and
+// the matched bytes, each followed by a NUL byte. DLP gives findings of
+// inspected content no stable identifier of its own. Offsets are left out
+// so the fingerprint survives edits elsewhere in the file, which means the
+// same value matched twice in one file has one fingerprint. When offsets do
+// not index data, as for documents, the match is the quote DLP returned, or
+// failing that the offsets.
+func setFingerprint(f *Finding, path string, data []byte, offsetsIndexData bool) {
+	var match []byte
+	switch {
+	case offsetsIndexData && f.Start >= 0 && f.Start <= f.End && f.End <= int64(len(data)):
+		match = data[f.Start:f.End]
+	case f.Quote != "":
+		match = []byte(f.Quote)
+	default:
+		match = []byte(fmt.Sprintf("%d-%d", f.Start, f.End))
+	}
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(path), []byte(f.InfoType), match} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	f.Fingerprint = hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// newFinding converts a DLP finding whose byte range is offset by base
+// within the inspected text
+func newFinding(f templateFinding, base int64) Finding {
+	byteRange := f.GetLocation().GetByteRange()
+	finding := Finding{
+		InfoType:   f.GetInfoType().GetName(),
+		Likelihood: f.GetLikelihood(),
+		Quote:      f.GetQuote(),
+		Start:      byteRange.GetStart() - base,
+		End:        byteRange.GetEnd() - base,
+		Template:   f.template,
+	}
+	for _, loc := range f.GetLocation().GetContentLocations() {
+		for _, box := range loc.GetImageLocation().GetBoundingBoxes() {
+			finding.BoundingBoxes = append(finding.BoundingBoxes, BoundingBox{
+				Top:    box.GetTop(),
+				Left:   box.GetLeft(),
+				Width:  box.GetWidth(),
+				Height: box.GetHeight(),
+			})
+		}
+	}
+	return finding
+}
@@ -0,0 +1,395 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// gitlinkMode is the tree entry mode git uses for submodule pointers
+const gitlinkMode = "160000"
+
+// SubmoduleUpdate describes a submodule pointer changed by a commit
+type SubmoduleUpdate struct {
+	Path string
+	// OldCommit is all zeros when the submodule was newly added
+	OldCommit string
+	NewCommit string
+}
+
+// gitCommand builds a git command that runs in dir, or the current directory when dir is empty
+func gitCommand(dir string, args ...string) *exec.Cmd {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	return exec.Command("git", args...)
+}
+
+// splitLines splits command output into non-empty lines, dropping the
+// carriage returns of CRLF line endings
+func splitLines(output []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// isZeroCommit reports whether sha is git's all-zeros placeholder
+func isZeroCommit(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+// CheckGitRepository confirms that git is installed and the current directory
+// is inside a work tree, so a hook run in the wrong place fails with a clear
+// message rather than a cryptic one from the first git command
+func CheckGitRepository() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return &GitError{Op: "git is not installed or not on PATH"}
+	}
+	output, err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Output()
+	if err != nil || strings.TrimSpace(string(output)) != "true" {
+		dir, _ := os.Getwd()
+		return &GitError{Op: fmt.Sprintf("%s is not inside a git work tree; run this from a repository checkout", dir)}
+	}
+	return nil
+}
+
+// GetRepositoryRoot returns the top-level directory of the current repository
+func GetRepositoryRoot() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", &GitError{Op: "failed to find repository root", Err: err}
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetHeadCommit returns the full SHA of HEAD
+func GetHeadCommit() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", &GitError{Op: "failed to resolve HEAD", Err: err}
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetUnpushedCommits lists the commits on HEAD that are not on the upstream
+// branch, oldest first. Without an upstream only HEAD itself is returned.
+func GetUnpushedCommits() ([]string, error) {
+	cmd := exec.Command("git", "rev-list", "--reverse", "@{u}..HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		cmd = exec.Command("git", "rev-parse", "HEAD")
+		output, err = cmd.Output()
+		if err != nil {
+			return nil, &GitError{Op: "failed to list unpushed commits", Err: err}
+		}
+	}
+	return splitLines(output), nil
+}
+
+// GetRecentUnpushedCommits lists at most the n most recent commits of
+// GetUnpushedCommits, oldest first
+func GetRecentUnpushedCommits(n int) ([]string, error) {
+	commits, err := GetUnpushedCommits()
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) > n {
+		commits = commits[len(commits)-n:]
+	}
+	return commits, nil
+}
+
+// HistoryRewritten reports whether HEAD no longer contains its upstream
+// branch, as after a rebase or amend of pushed commits, so pushing needs
+// --force. The unpushed commits then include every rewritten one.
+func HistoryRewritten() bool {
+	if exec.Command("git", "rev-parse", "--verify", "--quiet", "@{u}").Run() != nil {
+		return false
+	}
+	return exec.Command("git", "merge-base", "--is-ancestor", "@{u}", "HEAD").Run() != nil
+}
+
+// GetCommitsSince lists the commits in since..HEAD, oldest first
+func GetCommitsSince(since string) ([]string, error) {
+	cmd := exec.Command("git", "rev-list", "--reverse", since+"..HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to list commits since %s", since), Err: err}
+	}
+	return splitLines(output), nil
+}
+
+// GetMergeBase returns the best common ancestor of HEAD and ref, or of HEAD
+// and its upstream branch when ref is empty
+func GetMergeBase(ref string) (string, error) {
+	if ref == "" {
+		ref = "@{u}"
+	}
+	output, err := exec.Command("git", "merge-base", ref, "HEAD").Output()
+	if err != nil {
+		return "", &GitError{Op: fmt.Sprintf("failed to find the merge base of HEAD and %s", ref), Err: err}
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetChangedFilesInCommit lists the regular files added or modified by a commit
+func GetChangedFilesInCommit(commit string) ([]string, error) {
+	files, _, err := getCommitChanges("", commit)
+	return files, err
+}
+
+// GetSubmoduleUpdates lists the submodule pointers added or moved by a commit
+func GetSubmoduleUpdates(commit string) ([]SubmoduleUpdate, error) {
+	_, submodules, err := getCommitChanges("", commit)
+	return submodules, err
+}
+
+// getCommitChanges splits the entries added or modified by a commit in the
+// repository at dir into regular files and submodule pointer updates
+func getCommitChanges(dir, commit string) ([]string, []SubmoduleUpdate, error) {
+	// -z leaves paths unquoted, so names with spaces or non-ASCII characters
+	// come through as they are
+	cmd := gitCommand(dir, "diff-tree", "-z", "--root", "--no-commit-id", "-r", "--diff-filter=AM", commit)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, nil, &GitError{Op: fmt.Sprintf("failed to get changed files for commit %s", commit), Err: err}
+	}
+
+	var files []string
+	var submodules []SubmoduleUpdate
+	// Raw format: ":<old mode> <new mode> <old sha> <new sha> <status>\0<path>\0"
+	entries := strings.Split(string(output), "\x00")
+	for i := 0; i+1 < len(entries); i += 2 {
+		fields := strings.Fields(strings.TrimPrefix(entries[i], ":"))
+		path := entries[i+1]
+		if len(fields) < 5 {
+			continue
+		}
+		if fields[1] == gitlinkMode {
+			submodules = append(submodules, SubmoduleUpdate{Path: path, OldCommit: fields[2], NewCommit: fields[3]})
+			continue
+		}
+		files = append(files, path)
+	}
+	return files, submodules, nil
+}
+
+// getSubstantiveChanges returns the set of files a commit in the repository at
+// dir changes in more than whitespace. With -w, numstat leaves out files whose
+// only changes are whitespace.
+func getSubstantiveChanges(dir, commit string) (map[string]bool, error) {
+	cmd := gitCommand(dir, "diff-tree", "-z", "-w", "--numstat", "--root", "--no-commit-id", "-r", commit)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to diff commit %s ignoring whitespace", commit), Err: err}
+	}
+
+	files := make(map[string]bool)
+	for _, entry := range strings.Split(string(output), "\x00") {
+		// Format: "<added>\t<deleted>\t<path>", unquoted under -z
+		fields := strings.SplitN(entry, "\t", 3)
+		if len(fields) == 3 {
+			files[fields[2]] = true
+		}
+	}
+	return files, nil
+}
+
+// getDirtyFiles returns the set of files whose working-tree content differs
+// from their content at commit, staged or not
+func getDirtyFiles(commit string) (map[string]bool, error) {
+	// -z leaves paths unquoted, as in getCommitChanges
+	cmd := exec.Command("git", "diff", "-z", "--name-only", "--no-ext-diff", "--ignore-submodules", commit, "--")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to list uncommitted changes against %s", commit), Err: err}
+	}
+	files := make(map[string]bool)
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files[file] = true
+		}
+	}
+	return files, nil
+}
+
+// GetFileAtCommit returns a file's content as recorded in a commit
+func GetFileAtCommit(commit, path string) ([]byte, error) {
+	return getFileAtCommit("", commit, path)
+}
+
+// getFileAtCommit returns a file's content as recorded in a commit of the repository at dir
+func getFileAtCommit(dir, commit, path string) ([]byte, error) {
+	cmd := gitCommand(dir, "show", commit+":"+path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to read %s at commit %s", path, commit), Err: err}
+	}
+	return output, nil
+}
+
+// getCommitSubject returns the first line of a commit's message
+func getCommitSubject(dir, commit string) (string, error) {
+	output, err := gitCommand(dir, "log", "-1", "--format=%s", commit).Output()
+	if err != nil {
+		return "", &GitError{Op: fmt.Sprintf("failed to read the message of commit %s", commit), Err: err}
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// hasCommit reports whether the repository at dir is present and contains commit
+func hasCommit(dir, commit string) bool {
+	return gitCommand(dir, "cat-file", "-e", commit+"^{commit}").Run() == nil
+}
+
+// getSubmoduleCommits lists the commits a submodule update brings in, oldest
+// first. For a newly added submodule only commits not already on one of its
+// remotes are listed, since published history is not introduced by this push.
+func getSubmoduleCommits(dir string, update SubmoduleUpdate) ([]string, error) {
+	args := []string{"rev-list", "--reverse"}
+	if isZeroCommit(update.OldCommit) {
+		args = append(args, update.NewCommit, "--not", "--remotes")
+	} else {
+		args = append(args, update.OldCommit+".."+update.NewCommit)
+	}
+	output, err := gitCommand(dir, args...).Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to list commits for submodule %s", dir), Err: err}
+	}
+	return splitLines(output), nil
+}
+
+// getAnnotatedTags lists the annotated tags pointing at commit; lightweight
+// tags carry no text of their own
+func getAnnotatedTags(commit string) ([]string, error) {
+	cmd := exec.Command("git", "for-each-ref", "--points-at", commit, "--format=%(objecttype) %(refname)", "refs/tags")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to list tags of commit %s", commit), Err: err}
+	}
+	var tags []string
+	for _, line := range splitLines(output) {
+		if objectType, ref, ok := strings.Cut(line, " "); ok && objectType == "tag" {
+			tags = append(tags, ref)
+		}
+	}
+	return tags, nil
+}
+
+// getTagMessage returns the message of an annotated tag, without the header
+// naming the tagger
+func getTagMessage(ref string) ([]byte, error) {
+	output, err := exec.Command("git", "cat-file", "tag", ref).Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to read tag %s", ref), Err: err}
+	}
+	if i := strings.Index(string(output), "\n\n"); i >= 0 {
+		return output[i+2:], nil
+	}
+	return nil, nil
+}
+
+// getNote returns the note attached to commit under the default notes ref,
+// or nil when there is none
+func getNote(commit string) []byte {
+	output, err := exec.Command("git", "notes", "show", commit).Output()
+	if err != nil {
+		// git exits non-zero when the commit has no note
+		return nil
+	}
+	return output
+}
+
+// emptyTree is the id of git's empty tree, the base for a diff of a root commit
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// hunkHeader matches a diff hunk header, capturing the first new line number
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// addedLines is the text a diff adds to one file, with the line number each
+// added line has in the new version of the file
+type addedLines struct {
+	path  string
+	text  bytes.Buffer
+	lines []int
+}
+
+// GetPushBase returns the revision the unpushed commits build on: the
+// upstream branch, or without one the parent of HEAD, or the empty tree for
+// a root commit. It matches the commits GetUnpushedCommits lists.
+func GetPushBase() string {
+	for _, rev := range []string{"@{u}", "HEAD^"} {
+		if exec.Command("git", "rev-parse", "--verify", "--quiet", rev).Run() == nil {
+			return rev
+		}
+	}
+	return emptyTree
+}
+
+// getAddedLines returns the lines added between base and head, per file, as
+// one cumulative diff. Content added by one commit and removed by a later one
+// does not appear.
+func getAddedLines(base, head string) ([]*addedLines, error) {
+	cmd := exec.Command("git", "-c", "core.quotePath=false", "diff", "--no-color", "--no-ext-diff",
+		"--ignore-submodules", "--diff-filter=AM", "-U0", base, head)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to diff %s..%s", base, head), Err: err}
+	}
+	return parseAddedLines(string(output)), nil
+}
+
+// parseAddedLines collects the added lines of a zero-context diff, per file.
+// A "+++ " line is only a file header right after the "--- " line of a
+// file's header; within a hunk it is an added line that starts with "++ ".
+// -z does not apply to patch headers, so quoted paths are unquoted here.
+func parseAddedLines(output string) []*addedLines {
+	var files []*addedLines
+	var current *addedLines
+	line := 0
+	inHeader, afterMinus := false, false
+	for _, text := range strings.SplitAfter(output, "\n") {
+		headerLine := inHeader && afterMinus && strings.HasPrefix(text, "+++ ")
+		afterMinus = inHeader && strings.HasPrefix(text, "--- ")
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			current = nil
+			inHeader = true
+		case headerLine:
+			// git ends the name with a tab when it contains spaces
+			path := unquotePath(strings.TrimRight(strings.TrimPrefix(text, "+++ "), "\t\r\n"))
+			current = &addedLines{path: strings.TrimPrefix(path, "b/")}
+			files = append(files, current)
+		case strings.HasPrefix(text, "@@"):
+			inHeader = false
+			if m := hunkHeader.FindStringSubmatch(text); m != nil {
+				line, _ = strconv.Atoi(m[1])
+			}
+		case strings.HasPrefix(text, "+") && current != nil:
+			current.text.WriteString(text[1:])
+			current.lines = append(current.lines, line)
+			line++
+		}
+	}
+	return files
+}
+
+// unquotePath undoes the C-style quoting git gives paths in diff headers when
+// they hold control characters, quotes or backslashes, or non-ASCII
+// characters without core.quotePath=false. Git's escapes are a subset of Go's.
+func unquotePath(path string) string {
+	if strings.HasPrefix(path, `"`) {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			return unquoted
+		}
+	}
+	return path
+}
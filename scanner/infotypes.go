@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+	"github.com/googleapis/gax-go/v2"
+)
+
+// InfoTypeLister is the part of the DLP client that lists built-in info types
+type InfoTypeLister interface {
+	ListInfoTypes(ctx context.Context, req *dlppb.ListInfoTypesRequest, opts ...gax.CallOption) (*dlppb.ListInfoTypesResponse, error)
+}
+
+// ListInfoTypes returns the built-in info types DLP currently supports, by name
+func ListInfoTypes(ctx context.Context, lister InfoTypeLister) (map[string]*dlppb.InfoTypeDescription, error) {
+	resp, err := lister.ListInfoTypes(ctx, &dlppb.ListInfoTypesRequest{})
+	if err != nil {
+		return nil, &DLPError{Op: "failed to list info types", Err: err}
+	}
+	known := make(map[string]*dlppb.InfoTypeDescription)
+	for _, desc := range resp.GetInfoTypes() {
+		known[desc.GetName()] = desc
+	}
+	return known, nil
+}
+
+// Probe makes a lightweight request with a short deadline to confirm the DLP
+// API is reachable. Creating a client succeeds even when it is not, and the
+// failure would otherwise only surface partway through a scan.
+func Probe(ctx context.Context, lister InfoTypeLister, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := lister.ListInfoTypes(ctx, &dlppb.ListInfoTypesRequest{}); err != nil {
+		return &DLPError{Op: "DLP health probe failed", Err: err}
+	}
+	return nil
+}
+
+// CheckInfoTypes compares the built-in info types named by the config with
+// the ones DLP supports. DLP does not reject every unknown name, so a typo or
+// a retired info type can otherwise make a policy silently match nothing.
+// Deprecated types are recognised by their description. Custom regex and
+// dictionary names are not checked.
+func (c *Config) CheckInfoTypes(ctx context.Context, lister InfoTypeLister) ([]string, error) {
+	known, err := ListInfoTypes(ctx, lister)
+	if err != nil {
+		return nil, err
+	}
+
+	custom := make(map[string]bool)
+	for _, r := range c.Regexes {
+		custom[r.Name] = true
+	}
+	for _, d := range c.Dictionaries {
+		custom[d.Name] = true
+	}
+
+	configured := make(map[string]bool)
+	for _, name := range c.InfoTypes {
+		configured[name] = true
+	}
+	for _, rule := range c.PathRules {
+		for _, name := range rule.InfoTypes {
+			configured[name] = true
+		}
+	}
+
+	var warnings []string
+	for name := range configured {
+		if custom[name] {
+			continue
+		}
+		desc, ok := known[name]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("info type %s is not known to DLP and will never match", name))
+			continue
+		}
+		if strings.Contains(strings.ToLower(desc.GetDescription()), "deprecated") {
+			warnings = append(warnings, fmt.Sprintf("info type %s is deprecated: %s", name, desc.GetDescription()))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings, nil
+}
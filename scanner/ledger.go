@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ledgerFile is the name of the scanned-commit ledger inside the git directory
+const ledgerFile = "dlp-scanned-commits"
+
+// Ledger records commits that passed scanning, so later runs can skip them.
+// Commits are immutable, but a cleared commit may not pass a different
+// policy, so each entry is kept with a hash of the config it passed under
+// and only entries for the current config count.
+type Ledger struct {
+	path    string
+	policy  string
+	cleared map[string]bool
+}
+
+// policyHash identifies the scan policy of c, for keying saved results
+func (c *Config) policyHash() string {
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// OpenLedger loads the ledger of the current repository for the policy cfg.
+// A missing ledger is empty.
+func OpenLedger(cfg *Config) (*Ledger, error) {
+	output, err := exec.Command("git", "rev-parse", "--git-path", ledgerFile).Output()
+	if err != nil {
+		return nil, &GitError{Op: "failed to locate the scanned-commit ledger", Err: err}
+	}
+	l := &Ledger{
+		path:    strings.TrimSpace(string(output)),
+		policy:  cfg.policyHash(),
+		cleared: make(map[string]bool),
+	}
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read ledger %s: %v", l.path, err)
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 2 && fields[1] == l.policy {
+			l.cleared[fields[0]] = true
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("could not read ledger %s: %v", l.path, err)
+	}
+	return l, nil
+}
+
+// Forget ignores the commits loaded from the ledger for the rest of the run,
+// while still recording newly cleared ones
+func (l *Ledger) Forget() {
+	l.cleared = make(map[string]bool)
+}
+
+// Cleared reports whether commit passed scanning under the current policy
+func (l *Ledger) Cleared(commit string) bool {
+	return l.cleared[commit]
+}
+
+// Add records that commit passed scanning under the current policy
+func (l *Ledger) Add(commit string) error {
+	if l.cleared[commit] {
+		return nil
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open ledger %s: %v", l.path, err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s %s\n", commit, l.policy); err != nil {
+		return fmt.Errorf("could not write ledger %s: %v", l.path, err)
+	}
+	l.cleared[commit] = true
+	return nil
+}
@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// lfsPointerPrefix is the first line of every Git LFS pointer file
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1\n"
+
+// maxLFSPointerSize bounds the size of a pointer file; anything larger is real content
+const maxLFSPointerSize = 1024
+
+// parseLFSPointer returns the sha256 object ID of an LFS pointer, or false
+// when data is not a pointer
+func parseLFSPointer(data []byte) (string, bool) {
+	if len(data) > maxLFSPointerSize {
+		return "", false
+	}
+	// A pointer checked out with CRLF line endings is still a pointer
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(text, lfsPointerPrefix) {
+		return "", false
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if oid, ok := strings.CutPrefix(line, "oid sha256:"); ok && len(oid) == 64 {
+			return oid, true
+		}
+	}
+	return "", false
+}
+
+// resolveLFSPointer replaces an LFS pointer with the object it references,
+// read from the local LFS store of the repository at dir. The boolean is
+// false when data is not a pointer, in which case it is returned unchanged.
+func resolveLFSPointer(dir string, data []byte) ([]byte, bool, error) {
+	oid, ok := parseLFSPointer(data)
+	if !ok {
+		return data, false, nil
+	}
+
+	output, err := gitCommand(dir, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return nil, true, &GitError{Op: "failed to locate git directory", Err: err}
+	}
+	gitDir := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+
+	object, err := ioutil.ReadFile(filepath.Join(gitDir, "lfs", "objects", oid[0:2], oid[2:4], oid))
+	if err != nil {
+		return nil, true, fmt.Errorf("LFS object %.12s is not available locally", oid)
+	}
+	return object, true, nil
+}
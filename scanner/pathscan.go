@@ -0,0 +1,37 @@
+package scanner
+
+import "context"
+
+// pathSuffix names the content holding a file's path, so it is inspected as
+// plain text whatever the file's extension and cached apart from its content
+const pathSuffix = " (path)"
+
+// addPathFindings inspects the path of each file in result as text when
+// Config.ScanPaths is set, adding matches to the file as findings with
+// InPath set
+func (s *Scanner) addPathFindings(ctx context.Context, result *Result) error {
+	if !s.config.ScanPaths {
+		return nil
+	}
+	var contents []content
+	seen := make(map[string]bool)
+	for _, f := range result.Files {
+		if f.Skipped == SkippedOwnFile || seen[f.Path] {
+			continue
+		}
+		seen[f.Path] = true
+		contents = append(contents, content{path: f.Path + pathSuffix, data: []byte(f.Path)})
+	}
+	findings, _, err := s.scanContents(ctx, contents)
+	if err != nil {
+		return err
+	}
+	for i, f := range result.Files {
+		for _, finding := range findings[f.Path+pathSuffix] {
+			finding.InPath = true
+			finding.Line, finding.Column = 0, 0
+			result.Files[i].Findings = append(result.Files[i].Findings, finding)
+		}
+	}
+	return nil
+}
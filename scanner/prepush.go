@@ -0,0 +1,91 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// PushRef is one ref update git passes a pre-push hook on standard input
+type PushRef struct {
+	LocalRef  string
+	LocalSHA  string
+	RemoteRef string
+	// RemoteSHA is all zeros when the remote branch does not exist yet
+	RemoteSHA string
+}
+
+// Branch returns the name of the remote branch the update goes to, such as
+// main for refs/heads/main, or "" when it is not a branch
+func (r PushRef) Branch() string {
+	if !strings.HasPrefix(r.RemoteRef, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(r.RemoteRef, "refs/heads/")
+}
+
+// Deletion reports whether the update deletes the remote ref
+func (r PushRef) Deletion() bool {
+	return isZeroCommit(r.LocalSHA)
+}
+
+// ReadPushRefs parses the pre-push hook input, one
+// "<local ref> <local sha> <remote ref> <remote sha>" line per update
+func ReadPushRefs(r io.Reader) ([]PushRef, error) {
+	var refs []PushRef
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("malformed pre-push line %q", lines.Text())
+		}
+		refs = append(refs, PushRef{LocalRef: fields[0], LocalSHA: fields[1], RemoteRef: fields[2], RemoteSHA: fields[3]})
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("could not read pre-push refs: %v", err)
+	}
+	return refs, nil
+}
+
+// GetPushedCommits lists the commits an update brings to the remote, oldest
+// first: those reachable from the new commit but not the remote's current
+// one, which for a force push includes every rewritten commit. For a new
+// branch, or a remote commit not fetched yet, it lists those not on any
+// remote-tracking branch.
+func GetPushedCommits(ref PushRef) ([]string, error) {
+	args := []string{"rev-list", "--reverse"}
+	if isZeroCommit(ref.RemoteSHA) || !hasCommit("", ref.RemoteSHA) {
+		args = append(args, ref.LocalSHA, "--not", "--remotes")
+	} else {
+		args = append(args, ref.LocalSHA, "--not", ref.RemoteSHA)
+	}
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, &GitError{Op: fmt.Sprintf("failed to list commits pushed to %s", ref.RemoteRef), Err: err}
+	}
+	return splitLines(output), nil
+}
+
+// GetPushTarget returns the remote branch a plain git push updates: that of
+// the upstream branch, or without one the branch of the same name
+func GetPushTarget() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}").Output()
+	if err == nil {
+		// The upstream is named <remote>/<branch>
+		upstream := strings.TrimSpace(string(output))
+		if _, branch, ok := strings.Cut(upstream, "/"); ok {
+			return branch, nil
+		}
+		return upstream, nil
+	}
+	output, err = exec.Command("git", "symbolic-ref", "--short", "HEAD").Output()
+	if err != nil {
+		return "", &GitError{Op: "failed to find the branch being pushed", Err: err}
+	}
+	return strings.TrimSpace(string(output)), nil
+}
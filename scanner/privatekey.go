@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"bytes"
+	"regexp"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+)
+
+// PrivateKeyInfoType is the info type reported for PEM private key blocks
+const PrivateKeyInfoType = "PEM_PRIVATE_KEY"
+
+// privateKeyBegin matches the header line of a PEM private key block
+var privateKeyBegin = regexp.MustCompile(`-----BEGIN (RSA |EC |OPENSSH |)PRIVATE KEY-----`)
+
+// PrivateKeyDetector reports PEM private key blocks. DLP's built-in info
+// types do not reliably catch them, so every Scanner runs it locally.
+type PrivateKeyDetector struct{}
+
+// Detect returns a PrivateKeyInfoType finding spanning each key block, from
+// its header to the matching footer, or to the end of the header line when
+// the footer is missing
+func (PrivateKeyDetector) Detect(content []byte) []Finding {
+	var findings []Finding
+	for _, loc := range privateKeyBegin.FindAllSubmatchIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		footer := []byte("-----END " + string(content[loc[2]:loc[3]]) + "PRIVATE KEY-----")
+		if i := bytes.Index(content[end:], footer); i >= 0 {
+			end += i + len(footer)
+		}
+		findings = append(findings, Finding{
+			InfoType:   PrivateKeyInfoType,
+			Likelihood: dlppb.Likelihood_VERY_LIKELY,
+			Quote:      string(content[start:end]),
+			Start:      int64(start),
+			End:        int64(end),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,76 @@
+package scanner
+
+// GitProvider is the access to git history the scanner needs, so tests can
+// scan a fake tree without a repository. Tags, notes, uncommitted changes
+// and which lines a commit added, used to mark context findings, are only
+// read from a real repository, through ExecGit.
+type GitProvider interface {
+	// UnpushedCommits lists the commits not yet on the upstream branch, oldest first
+	UnpushedCommits() ([]string, error)
+	// ChangedFiles lists the regular files added or modified by a commit
+	ChangedFiles(commit string) ([]string, error)
+	// FileContentAt returns a file's content as recorded in a commit
+	FileContentAt(commit, path string) ([]byte, error)
+	// SubmoduleUpdates lists the submodule pointers added or moved by a commit
+	SubmoduleUpdates(commit string) ([]SubmoduleUpdate, error)
+	// SubstantiveChanges returns the set of files a commit changes in more
+	// than whitespace, or nil when every changed file should be scanned
+	SubstantiveChanges(commit string) (map[string]bool, error)
+	// CommitSubject returns the first line of a commit's message
+	CommitSubject(commit string) (string, error)
+}
+
+// ExecGit is the GitProvider that runs git in the repository at Dir, or the
+// current directory when Dir is empty
+type ExecGit struct {
+	Dir string
+}
+
+// UnpushedCommits implements GitProvider
+func (g ExecGit) UnpushedCommits() ([]string, error) {
+	if g.Dir != "" {
+		return nil, &GitError{Op: "unpushed commits are only listed for the current repository"}
+	}
+	return GetUnpushedCommits()
+}
+
+// ChangedFiles implements GitProvider
+func (g ExecGit) ChangedFiles(commit string) ([]string, error) {
+	files, _, err := getCommitChanges(g.Dir, commit)
+	return files, err
+}
+
+// FileContentAt implements GitProvider
+func (g ExecGit) FileContentAt(commit, path string) ([]byte, error) {
+	return getFileAtCommit(g.Dir, commit, path)
+}
+
+// SubmoduleUpdates implements GitProvider
+func (g ExecGit) SubmoduleUpdates(commit string) ([]SubmoduleUpdate, error) {
+	_, submodules, err := getCommitChanges(g.Dir, commit)
+	return submodules, err
+}
+
+// SubstantiveChanges implements GitProvider
+func (g ExecGit) SubstantiveChanges(commit string) (map[string]bool, error) {
+	return getSubstantiveChanges(g.Dir, commit)
+}
+
+// CommitSubject implements GitProvider
+func (g ExecGit) CommitSubject(commit string) (string, error) {
+	return getCommitSubject(g.Dir, commit)
+}
+
+// commitChanges lists the files a commit changes and the submodule updates
+// it makes, in one git call for a real repository
+func commitChanges(g GitProvider, commit string) ([]string, []SubmoduleUpdate, error) {
+	if e, ok := g.(ExecGit); ok {
+		return getCommitChanges(e.Dir, commit)
+	}
+	files, err := g.ChangedFiles(commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	submodules, err := g.SubmoduleUpdates(commit)
+	return files, submodules, err
+}
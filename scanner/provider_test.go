@@ -0,0 +1,171 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeCommit is a commit of a fakeGit tree
+type fakeCommit struct {
+	subject string
+	// files maps the paths the commit adds or modifies to their content
+	files map[string]string
+	// reformatted lists files whose only changes are whitespace
+	reformatted []string
+	submodules  []SubmoduleUpdate
+}
+
+// fakeGit is an in-memory GitProvider
+type fakeGit struct {
+	unpushed []string
+	commits  map[string]fakeCommit
+}
+
+func (g fakeGit) commit(sha string) (fakeCommit, error) {
+	c, ok := g.commits[sha]
+	if !ok {
+		return fakeCommit{}, &GitError{Op: fmt.Sprintf("unknown commit %s", sha)}
+	}
+	return c, nil
+}
+
+// UnpushedCommits implements GitProvider
+func (g fakeGit) UnpushedCommits() ([]string, error) {
+	return g.unpushed, nil
+}
+
+// ChangedFiles implements GitProvider
+func (g fakeGit) ChangedFiles(sha string) ([]string, error) {
+	c, err := g.commit(sha)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for path := range c.files {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// FileContentAt implements GitProvider
+func (g fakeGit) FileContentAt(sha, path string) ([]byte, error) {
+	c, err := g.commit(sha)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := c.files[path]
+	if !ok {
+		return nil, &GitError{Op: fmt.Sprintf("%s is not in commit %s", path, sha)}
+	}
+	return []byte(data), nil
+}
+
+// SubmoduleUpdates implements GitProvider
+func (g fakeGit) SubmoduleUpdates(sha string) ([]SubmoduleUpdate, error) {
+	c, err := g.commit(sha)
+	return c.submodules, err
+}
+
+// SubstantiveChanges implements GitProvider
+func (g fakeGit) SubstantiveChanges(sha string) (map[string]bool, error) {
+	c, err := g.commit(sha)
+	if err != nil || len(c.reformatted) == 0 {
+		return nil, err
+	}
+	substantive := make(map[string]bool)
+	for path := range c.files {
+		substantive[path] = true
+	}
+	for _, path := range c.reformatted {
+		delete(substantive, path)
+	}
+	return substantive, nil
+}
+
+// CommitSubject implements GitProvider
+func (g fakeGit) CommitSubject(sha string) (string, error) {
+	c, err := g.commit(sha)
+	return c.subject, err
+}
+
+func TestScanCommitFakeGit(t *testing.T) {
+	s, _ := newTestScanner(testMatches, nil)
+	s.UseGit(fakeGit{commits: map[string]fakeCommit{
+		"c1": {
+			subject: "Add contact details",
+			files: map[string]string{
+				"docs/contacts.md": "# Contacts\n\nalice@example.com\n",
+				"main.go":          "package main\n",
+				"util.go":          "package main\n\n// 555-867-5309\n",
+			},
+			reformatted: []string{"util.go"},
+			submodules:  []SubmoduleUpdate{{Path: "vendor/lib", OldCommit: "a1", NewCommit: "b2"}},
+		},
+	}})
+
+	result, err := s.ScanCommit(context.Background(), "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Commits) != 1 || result.Commits[0].Subject != "Add contact details" {
+		t.Errorf("commits = %v, want c1 with its subject", result.Commits)
+	}
+
+	files := make(map[string]FileResult)
+	for _, f := range result.Files {
+		files[f.Path] = f
+	}
+	if f := files["docs/contacts.md"]; len(f.Findings) != 1 || f.Findings[0].Line != 3 || f.Commit != "c1" {
+		t.Errorf("docs/contacts.md = %+v, want one finding on line 3 of c1", f)
+	}
+	if f := files["main.go"]; f.Skipped != "" || len(f.Findings) != 0 {
+		t.Errorf("main.go = %+v, want scanned and clean", f)
+	}
+	if f := files["util.go"]; f.Skipped != SkippedWhitespaceOnly {
+		t.Errorf("util.go skipped %q, want %q", f.Skipped, SkippedWhitespaceOnly)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "vendor/lib") {
+		t.Errorf("warnings = %v, want the submodule update that is not checked out", result.Warnings)
+	}
+}
+
+func TestScanCommitFakeGitFullScan(t *testing.T) {
+	s, _ := newTestScanner(testMatches, func(cfg *Config) {
+		cfg.ScanWhitespaceOnly = true
+	})
+	s.UseGit(fakeGit{commits: map[string]fakeCommit{
+		"c1": {files: map[string]string{"util.go": "// 555-867-5309\n"}, reformatted: []string{"util.go"}},
+	}})
+
+	result, err := s.ScanCommit(context.Background(), "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flagged := result.Flagged(); len(flagged) != 1 || flagged[0].Path != "util.go" {
+		t.Errorf("flagged %v, want util.go scanned despite only whitespace changing", flagged)
+	}
+}
+
+func TestScanCommitFakeGitError(t *testing.T) {
+	s, _ := newTestScanner(testMatches, nil)
+	s.UseGit(fakeGit{})
+	if _, err := s.ScanCommit(context.Background(), "missing"); err == nil {
+		t.Fatal("scanning an unknown commit succeeded")
+	}
+
+	s, _ = newTestScanner(testMatches, func(cfg *Config) {
+		cfg.AccumulateErrors = true
+	})
+	s.UseGit(fakeGit{})
+	result, err := s.ScanCommit(context.Background(), "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 {
+		t.Errorf("errors = %v, want the unknown commit recorded", result.Errors)
+	}
+}
@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// Redact returns data with the byte range of every finding replaced as its
+// info type's rule in masking says, or without one by its info type name in
+// brackets, the same output as DLP's replace-with-info-type transformation.
+// A finding overlapping an earlier one is folded into it. Findings in the
+// file's path are left out.
+//
+// Redaction does not call DeidentifyContent: DLP would inspect the content
+// again and transform what it finds, which need not be the findings left
+// after the allowlist, thresholds and suppressions, so the redacted output
+// could differ from what was reported. Replacing the reported byte ranges
+// keeps the two in step and saves a request per file; VerifyRedaction
+// inspects the result to catch anything missed.
+func Redact(data []byte, findings []Finding, masking map[string]MaskingRule) []byte {
+	var sorted []Finding
+	for _, f := range findings {
+		if !f.InPath {
+			sorted = append(sorted, f)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	var out strings.Builder
+	var pos int64
+	for _, f := range sorted {
+		if f.Start < pos || f.End > int64(len(data)) || f.Start >= f.End {
+			continue
+		}
+		out.Write(data[pos:f.Start])
+		out.WriteString(masking[f.InfoType].apply(f.InfoType, string(data[f.Start:f.End])))
+		pos = f.End
+	}
+	out.Write(data[pos:])
+	return []byte(out.String())
+}
+
+// VerifyRedaction inspects redacted, the redacted content of the file at
+// path, and returns the findings left in it, which mean the masking rules
+// or the original scan missed something
+func (s *Scanner) VerifyRedaction(ctx context.Context, path string, redacted []byte) ([]Finding, error) {
+	findings, skipped, err := s.scanContents(ctx, []content{{path: path, data: redacted}})
+	if err != nil {
+		return nil, err
+	}
+	if reason, ok := skipped[path]; ok {
+		return nil, fmt.Errorf("redacted %s could not be inspected: %s", path, reason)
+	}
+	return findings[path], nil
+}
+
+// apply returns the replacement for match, a finding of infoType. It gives
+// what DLP's ReplaceValueConfig, CharacterMaskConfig with a negative
+// NumberToMask, or ReplaceWithInfoTypeConfig would.
+func (r MaskingRule) apply(infoType, match string) string {
+	switch {
+	case r.Replacement != "":
+		return r.Replacement
+	case r.MaskingCharacter != "":
+		runes := []rune(match)
+		masked := len(runes) - r.RevealLast
+		if masked < 0 {
+			masked = 0
+		}
+		return strings.Repeat(r.MaskingCharacter, masked) + string(runes[masked:])
+	}
+	return "[" + infoType + "]"
+}
+
+// splitDiffLines splits text into lines, each ending in a newline
+func splitDiffLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "\n") {
+			lines[i] = line + "\n"
+		}
+	}
+	return lines
+}
+
+// RedactionDiff returns a unified diff between data and its redacted form,
+// or "" when redaction changes nothing. Redaction rarely adds or removes
+// lines; when it does, the whole file is shown as one hunk.
+func RedactionDiff(path string, data []byte, findings []Finding, masking map[string]MaskingRule) string {
+	redacted := Redact(data, findings, masking)
+	if string(redacted) == string(data) {
+		return ""
+	}
+	before := splitDiffLines(string(data))
+	after := splitDiffLines(string(redacted))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s (redacted)\n", path, path)
+	if len(before) != len(after) {
+		fmt.Fprintf(&out, "@@ -1,%d +1,%d @@\n", len(before), len(after))
+		for _, line := range before {
+			out.WriteString("-" + line)
+		}
+		for _, line := range after {
+			out.WriteString("+" + line)
+		}
+		return out.String()
+	}
+
+	var changed []int
+	for i := range before {
+		if before[i] != after[i] {
+			changed = append(changed, i)
+		}
+	}
+	for i := 0; i < len(changed); {
+		start := changed[i] - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk while the next change falls within its context
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*diffContext {
+			j++
+		}
+		end := changed[j] + diffContext + 1
+		if end > len(before) {
+			end = len(before)
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", start+1, end-start, start+1, end-start)
+		for k := start; k < end; k++ {
+			if before[k] == after[k] {
+				out.WriteString(" " + before[k])
+				continue
+			}
+			out.WriteString("-" + before[k])
+			out.WriteString("+" + after[k])
+		}
+		i = j + 1
+	}
+	return out.String()
+}
@@ -0,0 +1,242 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// ReportFinding is the JSON form of a Finding. The quote is left out so the
+// report does not itself contain the sensitive data.
+type ReportFinding struct {
+	InfoType   string `json:"infoType"`
+	Likelihood string `json:"likelihood"`
+	Start      int64  `json:"start"`
+	End        int64  `json:"end"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Template   string `json:"template,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Category   string `json:"category"`
+	// BoundingBoxes locate findings in images
+	BoundingBoxes []BoundingBox `json:"boundingBoxes,omitempty"`
+	// Action is block, warn or redact, see Config.Actions
+	Action string `json:"action"`
+	// Informational marks findings below their info type's likelihood threshold
+	Informational bool `json:"informational,omitempty"`
+	// InPath marks findings in the file's path; start and end index the path
+	InPath bool `json:"inPath,omitempty"`
+	// Context marks findings on lines the change did not add
+	Context bool `json:"context,omitempty"`
+	// Fingerprint identifies the finding across runs: a hash of the path,
+	// info type and matched text, without offsets
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Region is "code" or "comment" in source files whose comments are known
+	Region string `json:"region,omitempty"`
+}
+
+// ReportFile is the JSON form of a FileResult
+type ReportFile struct {
+	Path     string          `json:"path"`
+	Commit   string          `json:"commit,omitempty"`
+	RuleSet  string          `json:"ruleSet,omitempty"`
+	Skipped  string          `json:"skipped,omitempty"`
+	Findings []ReportFinding `json:"findings"`
+	// Sampled marks files only partly inspected; their findings are not exhaustive
+	Sampled bool `json:"sampled,omitempty"`
+	// Dirty marks working-tree files with uncommitted changes
+	Dirty bool `json:"dirty,omitempty"`
+	// InfoTypeCounts holds aggregate counts when individual findings are unavailable
+	InfoTypeCounts map[string]int64 `json:"infoTypeCounts,omitempty"`
+}
+
+// ReportSchemaVersion identifies the layout of Report. It changes when a field
+// is removed or changes meaning; fields may be added without a change.
+const ReportSchemaVersion = 1
+
+// ReportSummary aggregates the findings of a report
+type ReportSummary struct {
+	TotalFindings int64 `json:"totalFindings"`
+	// InfoTypes counts findings per info type
+	InfoTypes map[string]int64 `json:"infoTypes"`
+	// Categories counts findings per category
+	Categories map[string]int `json:"categories"`
+	// Blocked is true when the findings failed the operation
+	Blocked bool `json:"blocked"`
+	// RiskScore weighs the findings by category and likelihood, see Config.RiskScore
+	RiskScore float64 `json:"riskScore"`
+}
+
+// ReportCommit is a scanned commit with the files read from it
+type ReportCommit struct {
+	Commit  string       `json:"commit"`
+	Subject string       `json:"subject"`
+	Files   []ReportFile `json:"files"`
+}
+
+// ReportSkipped is a file whose content was not scanned
+type ReportSkipped struct {
+	Path   string `json:"path"`
+	Commit string `json:"commit,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Report is the structured record of one scan. Consumers should check
+// SchemaVersion; version 1 has these top-level fields:
+//
+//	schemaVersion  always 1
+//	timestamp      when the report was written, in UTC
+//	repository     top-level directory of the scanned repository
+//	operation      the scan mode: "push", "pre-push", "range", "last", "stdin", "filter", "file", "files", "gcs" or "inspect"
+//	summary        totals per info type and category, and whether it blocked
+//	files          every file scanned, with its findings (without quotes)
+//	commits        the commits scanned, in order, each with its files as above
+//	skipped        files not scanned, with the reason
+//	allowlisted    commits not scanned because the config allows them
+//	warnings       content that should have been scanned but could not be
+//	errors         operational failures collected during the scan
+type Report struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Repository    string          `json:"repository"`
+	Operation     string          `json:"operation"`
+	Summary       ReportSummary   `json:"summary"`
+	Files         []ReportFile    `json:"files"`
+	Commits       []ReportCommit  `json:"commits,omitempty"`
+	Skipped       []ReportSkipped `json:"skipped"`
+	Allowlisted   []string        `json:"allowlisted,omitempty"`
+	Warnings      []string        `json:"warnings,omitempty"`
+	Errors        []string        `json:"errors,omitempty"`
+}
+
+// NewReport builds the report for a scan result of the given operation
+// (e.g. "push") run in repository; blocked records whether it failed the
+// operation and riskScore is its Config.RiskScore
+func NewReport(operation, repository string, result *Result, blocked bool, riskScore float64) *Report {
+	report := &Report{
+		SchemaVersion: ReportSchemaVersion,
+		Timestamp:     time.Now().UTC(),
+		Repository:    repository,
+		Operation:     operation,
+		Summary: ReportSummary{
+			InfoTypes:  make(map[string]int64),
+			Categories: result.CategoryCounts(),
+			Blocked:    blocked,
+			RiskScore:  riskScore,
+		},
+		Files:    []ReportFile{},
+		Skipped:  []ReportSkipped{},
+		Warnings: result.Warnings,
+		Errors:   result.Errors,
+
+		Allowlisted: result.Allowlisted,
+	}
+	for _, f := range result.SkippedFiles() {
+		report.Skipped = append(report.Skipped, ReportSkipped{Path: f.Path, Commit: f.Commit, Reason: f.Skipped})
+	}
+	for _, f := range result.Files {
+		for name, count := range f.Stats {
+			report.Summary.InfoTypes[name] += count
+			report.Summary.TotalFindings += count
+		}
+		for _, finding := range f.Findings {
+			report.Summary.InfoTypes[finding.InfoType]++
+			report.Summary.TotalFindings++
+		}
+		report.Files = append(report.Files, newReportFile(f))
+	}
+	for _, c := range result.Commits {
+		commit := ReportCommit{Commit: c.SHA, Subject: c.Subject, Files: []ReportFile{}}
+		for _, f := range result.FilesInCommit(c.SHA) {
+			commit.Files = append(commit.Files, newReportFile(f))
+		}
+		report.Commits = append(report.Commits, commit)
+	}
+	return report
+}
+
+// newReportFile converts a FileResult to its JSON form
+func newReportFile(f FileResult) ReportFile {
+	file := ReportFile{
+		Path:     f.Path,
+		Commit:   f.Commit,
+		RuleSet:  f.RuleSet,
+		Skipped:  f.Skipped,
+		Findings: []ReportFinding{},
+
+		InfoTypeCounts: f.Stats,
+		Sampled:        f.Sampled,
+		Dirty:          f.Dirty,
+	}
+	for _, finding := range f.Findings {
+		file.Findings = append(file.Findings, ReportFinding{
+			InfoType:   finding.InfoType,
+			Likelihood: finding.Likelihood.String(),
+			Start:      finding.Start,
+			End:        finding.End,
+			Line:       finding.Line,
+			Column:     finding.Column,
+			Template:   finding.Template,
+			Field:      finding.Field,
+			Category:   finding.Category,
+
+			BoundingBoxes: finding.BoundingBoxes,
+			Action:        finding.Action,
+			Informational: finding.Informational,
+			InPath:        finding.InPath,
+			Context:       finding.Context,
+			Fingerprint:   finding.Fingerprint,
+			Region:        finding.Region,
+		})
+	}
+	return file
+}
+
+// CombinedReport holds the reports of several repositories scanned in one
+// run, each a Report as documented there. It shares the schema version of
+// Report and is told apart from one by its repositories field.
+type CombinedReport struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Blocked is true when any repository's findings blocked
+	Blocked      bool      `json:"blocked"`
+	Repositories []*Report `json:"repositories"`
+}
+
+// NewCombinedReport returns an empty combined report
+func NewCombinedReport() *CombinedReport {
+	return &CombinedReport{
+		SchemaVersion: ReportSchemaVersion,
+		Timestamp:     time.Now().UTC(),
+		Repositories:  []*Report{},
+	}
+}
+
+// Add appends the report of one repository
+func (c *CombinedReport) Add(r *Report) {
+	c.Repositories = append(c.Repositories, r)
+	c.Blocked = c.Blocked || r.Summary.Blocked
+}
+
+// WriteFile writes the combined report as indented JSON to path
+func (c *CombinedReport) WriteFile(path string) error {
+	return writeJSONFile(path, c)
+}
+
+// WriteFile writes the report as indented JSON to path
+func (r *Report) WriteFile(path string) error {
+	return writeJSONFile(path, r)
+}
+
+// writeJSONFile writes v as indented JSON to path
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode report: %v", err)
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write report %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryBudget bounds the retries made across every DLP call of a scan, so an
+// outage fails the scan quickly instead of multiplying per-call retries over
+// thousands of files
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining int
+	exhausted bool
+}
+
+// take uses up one retry, reporting false once none are left
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		b.exhausted = true
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// budgetRetryer retries transient DLP failures with backoff while the shared
+// budget lasts. It replaces the client's default per-call retry policy.
+type budgetRetryer struct {
+	budget  *retryBudget
+	backoff gax.Backoff
+}
+
+// Retry implements gax.Retryer
+func (r *budgetRetryer) Retry(err error) (time.Duration, bool) {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+	default:
+		return 0, false
+	}
+	if !r.budget.take() {
+		return 0, false
+	}
+	return r.backoff.Pause(), true
+}
+
+// retryOption returns the call option applying the scan's retry budget
+func (s *Scanner) retryOption() gax.CallOption {
+	return gax.WithRetry(func() gax.Retryer {
+		return &budgetRetryer{
+			budget: s.retries,
+			backoff: gax.Backoff{
+				Initial:    100 * time.Millisecond,
+				Max:        30 * time.Second,
+				Multiplier: 2,
+			},
+		}
+	})
+}
+
+// RetryBudgetExhausted reports whether the scan ran out of retries, after
+// which transient failures were not retried
+func (s *Scanner) RetryBudgetExhausted() bool {
+	s.retries.mu.Lock()
+	defer s.retries.mu.Unlock()
+	return s.retries.exhausted
+}
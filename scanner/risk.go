@@ -0,0 +1,51 @@
+package scanner
+
+import "cloud.google.com/go/dlp/apiv2/dlppb"
+
+// defaultRiskWeights is the risk each finding adds by category at the
+// highest likelihood. Config.RiskWeights adds to and overrides it.
+var defaultRiskWeights = map[string]float64{
+	CategoryCredentials: 10,
+	CategoryFinancial:   8,
+	CategoryHealth:      8,
+	CategoryPII:         5,
+	CategoryOther:       1,
+}
+
+// riskWeight returns the weight of a category, 1 for categories with none
+func (c *Config) riskWeight(category string) float64 {
+	if weight, ok := c.RiskWeights[category]; ok {
+		return weight
+	}
+	if weight, ok := defaultRiskWeights[category]; ok {
+		return weight
+	}
+	return 1
+}
+
+// likelihoodFactor scales a finding's risk by how sure DLP is of it, from
+// 0.2 for VERY_UNLIKELY to 1 for VERY_LIKELY. An unspecified likelihood
+// counts as POSSIBLE.
+func likelihoodFactor(likelihood dlppb.Likelihood) float64 {
+	if likelihood < dlppb.Likelihood_VERY_UNLIKELY || likelihood > dlppb.Likelihood_VERY_LIKELY {
+		likelihood = dlppb.Likelihood_POSSIBLE
+	}
+	return float64(likelihood) / float64(dlppb.Likelihood_VERY_LIKELY)
+}
+
+// RiskScore sums the weight of every finding in result by its category,
+// scaled by its likelihood. Aggregate counts from storage jobs carry no
+// likelihood and count as POSSIBLE. Informational findings are included,
+// since the data is there whether or not it blocks.
+func (c *Config) RiskScore(result *Result) float64 {
+	score := 0.0
+	for _, f := range result.Files {
+		for _, finding := range f.Findings {
+			score += c.riskWeight(c.CategoryOf(finding.InfoType)) * likelihoodFactor(finding.Likelihood)
+		}
+		for name, count := range f.Stats {
+			score += float64(count) * c.riskWeight(c.CategoryOf(name)) * likelihoodFactor(dlppb.Likelihood_POSSIBLE)
+		}
+	}
+	return score
+}
@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+)
+
+// SamplingConfig chooses the parts of an oversized file that are inspected
+// when Config.OversizedFiles is OversizedSample
+type SamplingConfig struct {
+	// HeadBytes and TailBytes are inspected at the start and end of the file
+	HeadBytes int `json:"headBytes"`
+	TailBytes int `json:"tailBytes"`
+	// Windows is the number of windows of WindowBytes spread evenly between
+	// the head and the tail
+	Windows     int `json:"windows"`
+	WindowBytes int `json:"windowBytes"`
+}
+
+// validate checks that every sample fits in one request
+func (c SamplingConfig) validate() error {
+	for _, n := range []int{c.HeadBytes, c.TailBytes, c.WindowBytes} {
+		if n < 0 || n > maxRequestBytes {
+			return fmt.Errorf("sampling headBytes, tailBytes and windowBytes must be between 0 and %d", maxRequestBytes)
+		}
+	}
+	if c.Windows < 0 || c.Windows > 0 && c.WindowBytes == 0 {
+		return fmt.Errorf("sampling windows must not be negative and need windowBytes")
+	}
+	return nil
+}
+
+// ranges returns the byte ranges of content of the given size to inspect,
+// in order and without overlap
+func (c SamplingConfig) ranges(size int64) [][2]int64 {
+	var ranges [][2]int64
+	add := func(start, end int64) {
+		if n := len(ranges); n > 0 && start < ranges[n-1][1] {
+			start = ranges[n-1][1]
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > size {
+			end = size
+		}
+		if start < end {
+			ranges = append(ranges, [2]int64{start, end})
+		}
+	}
+	head, tail := int64(c.HeadBytes), size-int64(c.TailBytes)
+	add(0, head)
+	if c.Windows > 0 && tail > head {
+		gap := (tail - head) / int64(c.Windows+1)
+		for i := 1; i <= c.Windows; i++ {
+			start := head + gap*int64(i) - int64(c.WindowBytes)/2
+			add(start, start+int64(c.WindowBytes))
+		}
+	}
+	add(tail, size)
+	return ranges
+}
+
+// sample splits oversized content into one single-entry batch per sampled
+// range, like chunk does for the whole of it
+func sample(path string, data []byte, c SamplingConfig) []*batch {
+	var batches []*batch
+	for _, r := range c.ranges(int64(len(data))) {
+		b := single(path, data[r[0]:r[1]])
+		b.entries[0].origin = r[0]
+		batches = append(batches, b)
+	}
+	return batches
+}
+
+// sampled reports whether content is inspected in samples rather than whole
+func (s *Scanner) sampled(c content) bool {
+	if s.config.OversizedFiles != OversizedSample || len(c.data) <= maxRequestBytes {
+		return false
+	}
+	_, isDocument := documentBytesType(c.path, c.data)
+	return !isDocument
+}
+
+// markSampled flags the files of result whose content in contents was only
+// sampled
+func (s *Scanner) markSampled(result *Result, contents []content) {
+	sampled := make(map[string]bool)
+	for _, c := range contents {
+		if s.sampled(c) {
+			sampled[c.path] = true
+		}
+	}
+	for i, f := range result.Files {
+		if sampled[f.Path] && f.Skipped == "" {
+			result.Files[i].Sampled = true
+		}
+	}
+}
+
+// sampleFile inspects the ranges of an oversized working-tree file of the
+// given size that Config.Sampling chooses, reading only those. Findings
+// outside the head have no line number. It returns the findings, or the
+// reason the file was skipped.
+func (s *Scanner) sampleFile(ctx context.Context, path string, f *os.File, size int64) ([]Finding, string, error) {
+	inspectConfig := s.config.InspectConfigForPath(path)
+	var findings []Finding
+	for _, r := range s.config.Sampling.ranges(size) {
+		window := make([]byte, r[1]-r[0])
+		fetchStart := time.Now()
+		_, err := f.ReadAt(window, r[0])
+		s.track(PhaseFetch, fetchStart)
+		if err != nil && err != io.EOF {
+			return nil, "", fmt.Errorf("could not read %s: %v", path, err)
+		}
+		if r[0] == 0 {
+			if _, ok := documentBytesType(path, window); ok {
+				// Documents must be inspected whole
+				return nil, SkippedOversized, nil
+			}
+		}
+		local, reason, err := s.inspectWindow(ctx, path, inspectConfig, window)
+		if err != nil || reason != "" {
+			return nil, reason, err
+		}
+		for _, f := range local {
+			setFingerprint(&f, path, window, true)
+			if r[0] == 0 {
+				f.Line, f.Column = lineColumn(window, f.Start)
+			}
+			f.Start += r[0]
+			f.End += r[0]
+			findings = append(findings, f)
+		}
+	}
+
+	findings = s.excludeFindings(findings)
+	for i := range findings {
+		s.applyPolicy(&findings[i])
+	}
+	return findings, "", nil
+}
+
+// inspectWindow inspects one window of a file with DLP and the local
+// detectors, returning findings with offsets within the window, or the
+// reason it was skipped
+func (s *Scanner) inspectWindow(ctx context.Context, path string, inspectConfig *dlppb.InspectConfig, window []byte) ([]Finding, string, error) {
+	reqCtx, cancel := s.requestContext(ctx)
+	found, truncated, err := s.inspectText(reqCtx, inspectConfig, string(window))
+	expired := reqCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+	cancel()
+	if err != nil {
+		if expired {
+			return nil, SkippedTimedOut, nil
+		}
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	if truncated {
+		// Windows are not rescanned
+		s.markTruncated(path)
+	}
+	var local []Finding
+	for _, f := range found {
+		local = append(local, newFinding(f, 0))
+	}
+	for _, d := range s.detectors {
+		local = append(local, d.Detect(window)...)
+	}
+	return local, "", nil
+}
@@ -0,0 +1,1068 @@
+// Package scanner inspects git content for sensitive data using Google Cloud DLP.
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dlp "cloud.google.com/go/dlp/apiv2"
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// SkippedWhitespaceOnly is the Skipped reason for files a commit only reformats
+const SkippedWhitespaceOnly = "whitespace-only change"
+
+// SkippedTimedOut is the Skipped reason for files whose inspection ran past
+// the per-file timeout
+const SkippedTimedOut = "scan timed out"
+
+// SkippedOwnFile is the Skipped reason for the scanner's own config and
+// credential files, which may legitimately hold tokens
+const SkippedOwnFile = "excluded as the scanner's own config or credentials"
+
+// SkippedOversized is the Skipped reason for files too large for a single
+// DLP request when Config.OversizedFiles is OversizedSkip
+const SkippedOversized = "too large for a single DLP request"
+
+// FileResult holds the findings for one scanned file
+type FileResult struct {
+	Path string
+	// Commit is the commit the content was read from, empty for the working tree
+	Commit   string
+	Findings []Finding
+	// Skipped explains why the file's content was not scanned, if it was not
+	Skipped string
+	// RuleSet names the info type set the file was scanned with
+	RuleSet string
+	// Stats counts findings per info type when only aggregates are known,
+	// as for Cloud Storage inspection jobs
+	Stats map[string]int64
+	// StatActions holds the action for each info type in Stats
+	StatActions map[string]string
+	// Sampled is set when only parts of the oversized file were inspected,
+	// see OversizedSample; its findings are not exhaustive
+	Sampled bool
+	// Dirty is set when the working-tree file scanned has uncommitted
+	// changes, so it is not what the push holds; see Config.DirtyFiles
+	Dirty bool
+}
+
+// SampledNotExhaustive describes the findings of a sampled file
+const SampledNotExhaustive = "sampled, not exhaustive"
+
+// sensitive reports whether the file had any findings
+func (f FileResult) sensitive() bool {
+	if len(f.Findings) > 0 {
+		return true
+	}
+	for _, count := range f.Stats {
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// InfoTypes returns the distinct info type names found in the file, sorted
+func (f FileResult) InfoTypes() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, finding := range f.Findings {
+		name := finding.InfoType
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for name, count := range f.Stats {
+		if count > 0 && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CommitInfo identifies a scanned commit for people reading the results
+type CommitInfo struct {
+	SHA     string
+	Subject string
+}
+
+// Result collects the per-file outcome of a scan
+type Result struct {
+	Files []FileResult
+	// Commits lists the commits scanned, in order, which FileResult.Commit refers to
+	Commits []CommitInfo
+	// Warnings lists content that should have been scanned but could not be
+	Warnings []string
+	// Errors lists operational failures, such as git commands that failed,
+	// collected instead of aborting when Config.AccumulateErrors is set
+	Errors []string
+	// Allowlisted lists commits skipped under Config.AllowedCommits
+	Allowlisted []string
+}
+
+// merge appends another result's files, commits, warnings and errors to r
+func (r *Result) merge(other *Result) {
+	r.Files = append(r.Files, other.Files...)
+	r.Commits = append(r.Commits, other.Commits...)
+	r.Warnings = append(r.Warnings, other.Warnings...)
+	r.Errors = append(r.Errors, other.Errors...)
+	r.Allowlisted = append(r.Allowlisted, other.Allowlisted...)
+}
+
+// recordError adds err to result when Config.AccumulateErrors is set, so the
+// scan can carry on, and returns it unchanged otherwise
+func (s *Scanner) recordError(result *Result, err error) error {
+	if !s.config.AccumulateErrors {
+		return err
+	}
+	result.Errors = append(result.Errors, err.Error())
+	return nil
+}
+
+// Sensitive reports whether any scanned file had findings
+func (r *Result) Sensitive() bool {
+	for _, f := range r.Files {
+		if f.sensitive() {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocks reports whether any file has a finding of one of the failOn info
+// types, or of any type when failOn is empty. Informational findings and
+// findings whose action is ActionWarn never block.
+func (r *Result) Blocks(failOn []string) bool {
+	for _, f := range r.Files {
+		for _, finding := range f.Findings {
+			if finding.Blocks(failOn) {
+				return true
+			}
+		}
+		for name, count := range f.Stats {
+			if count > 0 && f.StatActions[name] != ActionWarn && blocksOn(failOn, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// blocksOn reports whether infoType is one of failOn, or failOn is empty
+func blocksOn(failOn []string, infoType string) bool {
+	if len(failOn) == 0 {
+		return true
+	}
+	for _, blocking := range failOn {
+		if infoType == blocking {
+			return true
+		}
+	}
+	return false
+}
+
+// SkippedFiles returns the files whose content was not scanned
+func (r *Result) SkippedFiles() []FileResult {
+	var skipped []FileResult
+	for _, f := range r.Files {
+		if f.Skipped != "" {
+			skipped = append(skipped, f)
+		}
+	}
+	return skipped
+}
+
+// cleared reports whether every file was scanned without findings or
+// problems, apart from those skipped as reformatted or as the scanner's own
+func (r *Result) cleared() bool {
+	// Allowlisted commits were not scanned, so they have not passed the policy
+	if r.Sensitive() || len(r.Warnings) > 0 || len(r.Errors) > 0 || len(r.Allowlisted) > 0 {
+		return false
+	}
+	return len(r.Unscanned()) == 0
+}
+
+// Unscanned returns the skipped files whose content was left unchecked,
+// leaving out files skipped as reformatted or as the scanner's own
+func (r *Result) Unscanned() []FileResult {
+	var unscanned []FileResult
+	for _, f := range r.SkippedFiles() {
+		if f.Skipped != SkippedWhitespaceOnly && f.Skipped != SkippedOwnFile {
+			unscanned = append(unscanned, f)
+		}
+	}
+	return unscanned
+}
+
+// FilesInCommit returns the files read from commit
+func (r *Result) FilesInCommit(commit string) []FileResult {
+	var files []FileResult
+	for _, f := range r.Files {
+		if f.Commit == commit {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Flagged returns the files that had findings
+func (r *Result) Flagged() []FileResult {
+	var flagged []FileResult
+	for _, f := range r.Files {
+		if f.sensitive() {
+			flagged = append(flagged, f)
+		}
+	}
+	return flagged
+}
+
+// Inspector is the part of the DLP client the scanner depends on. *dlp.Client
+// satisfies it; tests can substitute a fake that returns canned findings.
+type Inspector interface {
+	InspectContent(ctx context.Context, req *dlppb.InspectContentRequest, opts ...gax.CallOption) (*dlppb.InspectContentResponse, error)
+}
+
+// Scanner runs DLP inspections for a project and scan policy
+type Scanner struct {
+	client Inspector
+	config *Config
+	cache  *findingCache
+
+	mu sync.Mutex
+	// suppressed counts findings dropped by Config.ExcludeInfoTypes
+	suppressed map[string]int
+	// ownFiles holds the repository-relative paths of the scanner's own files
+	ownFiles map[string]bool
+	// retries is shared by every DLP call, see Config.RetryBudget
+	retries *retryBudget
+	// detectors run locally on every text file alongside DLP
+	detectors []Detector
+	// ledger, when set, lets ScanCommits skip commits that already passed
+	ledger        *Ledger
+	ledgerSkipped int
+	// truncated counts requests whose findings hit Config.MaxFindingsPerRequest
+	truncated int
+	// truncatedFiles holds the files whose findings may be incomplete for it
+	truncatedFiles map[string]bool
+	// git reads commits for ScanCommit, see UseGit
+	git GitProvider
+	// timings sums the time spent in each phase, see Timings
+	timings map[string]time.Duration
+}
+
+// ClientOptions configures the gRPC channel of a DLP client.
+//
+// One client should be created per process and shared by every scan; each
+// client owns its connections, so creating clients per call pays the TLS and
+// HTTP/2 handshake every time. Keepalive pings hold idle connections open
+// between bursts of requests at the cost of a little background traffic, and
+// detect dead connections sooner than TCP would. Each connection in the pool
+// carries a bounded number of concurrent streams (the DLP frontend allows
+// about 100), so raise PoolSize only when running more concurrent requests
+// than that; extra connections cost memory and handshakes.
+type ClientOptions struct {
+	// CredentialsFile is a service account key file; empty uses Application Default Credentials
+	CredentialsFile string
+	// KeepaliveTime is how long a connection may be idle before it is pinged; zero disables pings
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is how long to wait for a ping ack before closing the connection
+	KeepaliveTimeout time.Duration
+	// PoolSize is the number of gRPC connections to spread requests over; zero uses the library default
+	PoolSize int
+}
+
+// DefaultClientOptions returns channel settings suited to sustained scanning
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		KeepaliveTime:    30 * time.Second,
+		KeepaliveTimeout: 10 * time.Second,
+	}
+}
+
+// NewClient creates a DLP client with the given channel settings, using the
+// service account key file when set and Application Default Credentials otherwise
+func NewClient(ctx context.Context, opts ClientOptions) (*dlp.Client, error) {
+	var clientOpts []option.ClientOption
+	if opts.CredentialsFile != "" {
+		info, err := os.Stat(opts.CredentialsFile)
+		if err != nil {
+			return nil, &ConfigError{Op: fmt.Sprintf("credentials file %s is not accessible", opts.CredentialsFile), Err: err}
+		}
+		if info.IsDir() {
+			return nil, &ConfigError{Op: fmt.Sprintf("credentials file %s is a directory", opts.CredentialsFile)}
+		}
+		clientOpts = append(clientOpts, option.WithCredentialsFile(opts.CredentialsFile))
+	}
+	if opts.KeepaliveTime > 0 {
+		clientOpts = append(clientOpts, option.WithGRPCDialOption(grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    opts.KeepaliveTime,
+			Timeout: opts.KeepaliveTimeout,
+		})))
+	}
+	if opts.PoolSize > 0 {
+		clientOpts = append(clientOpts, option.WithGRPCConnectionPool(opts.PoolSize))
+	}
+
+	client, err := dlp.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, &DLPError{Op: "failed to create DLP client", Err: err}
+	}
+	return client, nil
+}
+
+// New returns a Scanner that inspects content with client under cfg
+func New(client Inspector, cfg *Config) *Scanner {
+	s := &Scanner{
+		client:     client,
+		config:     cfg,
+		cache:      newFindingCache(cfg.Cache),
+		suppressed: make(map[string]int),
+		ownFiles:   make(map[string]bool),
+		timings:    make(map[string]time.Duration),
+		retries:    &retryBudget{remaining: cfg.RetryBudget},
+		detectors:  []Detector{PrivateKeyDetector{}},
+		git:        ExecGit{},
+
+		truncatedFiles: make(map[string]bool),
+	}
+	if cfg.Entropy.Enabled {
+		s.AddDetector(EntropyDetector{Threshold: cfg.Entropy.Threshold, MinLength: cfg.Entropy.MinLength})
+	}
+	return s
+}
+
+// UseLedger makes ScanCommits skip the commits l has cleared and record the
+// ones that pass. It must be called before scanning starts.
+func (s *Scanner) UseLedger(l *Ledger) {
+	s.ledger = l
+}
+
+// UseGit makes ScanCommit read commits through g instead of running git in
+// the current directory, such as a fake tree in tests. It must be called
+// before scanning starts.
+func (s *Scanner) UseGit(g GitProvider) {
+	s.git = g
+}
+
+// TruncatedRequests returns how many DLP requests returned only some of
+// their findings because of Config.MaxFindingsPerRequest
+func (s *Scanner) TruncatedRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.truncated
+}
+
+// TruncatedFiles returns the files, sorted, whose findings may be incomplete
+// because a request holding them was truncated, even after
+// Config.RescanTruncated
+func (s *Scanner) TruncatedFiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make([]string, 0, len(s.truncatedFiles))
+	for path := range s.truncatedFiles {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// markTruncated records that the findings of path may be incomplete
+func (s *Scanner) markTruncated(path string) {
+	s.mu.Lock()
+	s.truncatedFiles[path] = true
+	s.mu.Unlock()
+}
+
+// isTruncated reports whether the findings of path may be incomplete
+func (s *Scanner) isTruncated(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.truncatedFiles[path]
+}
+
+// LedgerSkipped returns how many commits were skipped as already cleared
+func (s *Scanner) LedgerSkipped() int {
+	return s.ledgerSkipped
+}
+
+// AddDetector registers a local detector to run on every text file scanned.
+// It must be called before scanning starts.
+func (s *Scanner) AddDetector(d Detector) {
+	s.detectors = append(s.detectors, d)
+}
+
+// ExcludeOwnFiles keeps the scanner's own config and credential files out of
+// scans of the repository at root, so they do not flag themselves. Paths are
+// resolved against the current directory; empty paths and paths outside the
+// repository are ignored. Each call replaces the files the last one excluded,
+// so it can be called again for the next repository scanned.
+func (s *Scanner) ExcludeOwnFiles(root string, paths ...string) {
+	s.ownFiles = make(map[string]bool)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		s.ownFiles[filepath.ToSlash(rel)] = true
+	}
+}
+
+// Config returns the scan policy in use
+func (s *Scanner) Config() *Config {
+	return s.config
+}
+
+// Inspect sends text to Google Cloud DLP and returns the raw findings
+func (s *Scanner) Inspect(ctx context.Context, text string) ([]*dlppb.Finding, error) {
+	found, err := s.inspectWith(ctx, s.config.InspectConfig(), text)
+	if err != nil {
+		return nil, err
+	}
+	findings := make([]*dlppb.Finding, len(found))
+	for i, f := range found {
+		findings[i] = f.Finding
+	}
+	return findings, nil
+}
+
+// inspectWith sends text to Google Cloud DLP under the given inspect configuration
+func (s *Scanner) inspectWith(ctx context.Context, inspectConfig *dlppb.InspectConfig, text string) ([]templateFinding, error) {
+	found, _, err := s.inspectText(ctx, inspectConfig, text)
+	return found, err
+}
+
+// inspectText is inspectWith, also reporting whether DLP truncated the findings
+func (s *Scanner) inspectText(ctx context.Context, inspectConfig *dlppb.InspectConfig, text string) ([]templateFinding, bool, error) {
+	return s.inspectItem(ctx, inspectConfig, &dlppb.ContentItem{
+		DataItem: &dlppb.ContentItem_Value{Value: text},
+	})
+}
+
+// templateFinding is a DLP finding with the inspect template that produced
+// it, empty for the local inspect configuration
+type templateFinding struct {
+	*dlppb.Finding
+	template string
+}
+
+// inspectItem sends a content item to Google Cloud DLP under the given
+// inspect configuration and each of Config.InspectTemplates. DLP takes one
+// template per request, so each template costs a request of its own; the
+// local configuration is skipped when it names no info types. Findings of
+// the same info type at the same place are reported once, by whichever ran
+// first. The boolean is set when any request's findings were truncated.
+func (s *Scanner) inspectItem(ctx context.Context, inspectConfig *dlppb.InspectConfig, contentItem *dlppb.ContentItem) ([]templateFinding, bool, error) {
+	var found []templateFinding
+	var truncated bool
+	seen := make(map[string]bool)
+	add := func(template string, findings []*dlppb.Finding) {
+		for _, f := range findings {
+			r := f.GetLocation().GetByteRange()
+			key := fmt.Sprintf("%s %d %d", f.GetInfoType().GetName(), r.GetStart(), r.GetEnd())
+			if !seen[key] {
+				seen[key] = true
+				found = append(found, templateFinding{Finding: f, template: template})
+			}
+		}
+	}
+
+	templates := s.config.InspectTemplates
+	if len(templates) == 0 || len(inspectConfig.GetInfoTypes())+len(inspectConfig.GetCustomInfoTypes()) > 0 {
+		findings, cut, err := s.inspectRequest(ctx, "", inspectConfig, contentItem)
+		if err != nil {
+			return nil, false, err
+		}
+		truncated = truncated || cut
+		add("", findings)
+	}
+	for _, template := range templates {
+		// Fields set here override the template's, so only ask for quotes
+		// and keep the findings cap
+		findings, cut, err := s.inspectRequest(ctx, template, &dlppb.InspectConfig{IncludeQuote: inspectConfig.GetIncludeQuote(), Limits: inspectConfig.GetLimits()}, contentItem)
+		if err != nil {
+			return nil, false, fmt.Errorf("template %s: %w", template, err)
+		}
+		truncated = truncated || cut
+		add(template, findings)
+	}
+	return found, truncated, nil
+}
+
+// inspectRequest makes one InspectContent call, under template when it is
+// not empty. The boolean is set when DLP flagged the findings as truncated.
+func (s *Scanner) inspectRequest(ctx context.Context, template string, inspectConfig *dlppb.InspectConfig, contentItem *dlppb.ContentItem) ([]*dlppb.Finding, bool, error) {
+	defer s.track(PhaseDLP, time.Now())
+	req := &dlppb.InspectContentRequest{
+		Parent:              s.config.ParentPath(),
+		Item:                contentItem,
+		InspectConfig:       inspectConfig,
+		InspectTemplateName: template,
+	}
+
+	resp, err := s.client.InspectContent(ctx, req, s.retryOption())
+	if err != nil && s.RetryBudgetExhausted() {
+		return nil, false, &DLPError{Op: fmt.Sprintf("failed to inspect content (retry budget of %d exhausted)", s.config.RetryBudget), Err: err}
+	}
+	if err != nil {
+		return nil, false, &DLPError{Op: "failed to inspect content", Err: err}
+	}
+	truncated := resp.GetResult().GetFindingsTruncated()
+	if truncated {
+		s.mu.Lock()
+		s.truncated++
+		s.mu.Unlock()
+	}
+	return resp.Result.Findings, truncated, nil
+}
+
+// IsConnectivityError reports whether err means the DLP API could not be
+// reached, as opposed to rejecting the request
+func IsConnectivityError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsQuotaError reports whether err means the DLP quota for the project was exhausted
+func IsQuotaError(err error) bool {
+	return status.Code(err) == codes.ResourceExhausted
+}
+
+// isCancellation reports whether err is a cancelled context, either directly
+// or as the Canceled status of a gRPC call that was in flight
+func isCancellation(err error) bool {
+	return status.Code(err) == codes.Canceled || errors.Is(err, context.Canceled)
+}
+
+// DLPScan scans a given text for sensitive data using Google Cloud DLP
+func (s *Scanner) DLPScan(ctx context.Context, text string) (bool, error) {
+	findings, err := s.Inspect(ctx, text)
+	if err != nil {
+		return false, err
+	}
+
+	// Findings below their info type's likelihood threshold do not count
+	for _, f := range findings {
+		if !s.config.Informational(f.GetInfoType().GetName(), f.GetLikelihood()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// selfTestText is the synthetic sample inspected by SelfTest
+const selfTestText = "DLP self-test contact: selftest@example.com"
+
+// SelfTest inspects a synthetic email address to confirm that DLP can be
+// reached with working credentials and permissions and that it reports the
+// address
+func (s *Scanner) SelfTest(ctx context.Context) error {
+	findings, err := s.inspectWith(ctx, s.config.inspectConfigWith([]string{"EMAIL_ADDRESS"}), selfTestText)
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		if f.GetInfoType().GetName() == "EMAIL_ADDRESS" {
+			return nil
+		}
+	}
+	return &DLPError{Op: "DLP returned no EMAIL_ADDRESS finding for the synthetic sample"}
+}
+
+// ScanFile reads file content and performs a DLP scan on it
+func (s *Scanner) ScanFile(ctx context.Context, filename string) ([]*dlppb.Finding, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: %v", err)
+	}
+	return s.Inspect(ctx, string(data))
+}
+
+// ScanCommit scans the content of every file added or modified by a commit,
+// as recorded in that commit. Submodule pointer updates are followed into the
+// submodule when it is checked out. A commit in Config.AllowedCommits is
+// not read at all and is recorded in Result.Allowlisted instead.
+func (s *Scanner) ScanCommit(ctx context.Context, commit string) (*Result, error) {
+	if s.config.CommitAllowed(commit) {
+		return &Result{Allowlisted: []string{commit}}, nil
+	}
+	return s.scanCommit(ctx, "", commit)
+}
+
+// scanCommit scans a commit of the repository at dir, reporting paths
+// relative to the top-level repository
+func (s *Scanner) scanCommit(ctx context.Context, dir, commit string) (*Result, error) {
+	gitStart := time.Now()
+	git := s.git
+	if dir != "" {
+		git = ExecGit{Dir: dir}
+	}
+	// The subject only labels the commit in output, so it may be missing
+	subject, _ := git.CommitSubject(commit)
+	result := &Result{Commits: []CommitInfo{{SHA: commit, Subject: subject}}}
+	files, submodules, err := commitChanges(git, commit)
+	if err != nil {
+		if err := s.recordError(result, err); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	var substantive map[string]bool
+	if !s.config.ScanWhitespaceOnly {
+		substantive, err = git.SubstantiveChanges(commit)
+		if err != nil {
+			if err := s.recordError(result, err); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+	var added map[string]map[int]bool
+	if _, isRepository := git.(ExecGit); isRepository {
+		added, err = commitAddedLines(dir, commit)
+		if err != nil {
+			if err := s.recordError(result, err); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+	s.track(PhaseGit, gitStart)
+
+	var contents []content
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if !s.config.Included(path) {
+			continue
+		}
+		if dir == "" && s.ownFiles[file] {
+			result.Files = append(result.Files, FileResult{Path: path, Commit: commit, Skipped: SkippedOwnFile})
+			continue
+		}
+		if substantive != nil && !substantive[file] {
+			result.Files = append(result.Files, FileResult{Path: path, Commit: commit, Skipped: SkippedWhitespaceOnly})
+			continue
+		}
+		fetchStart := time.Now()
+		data, err := git.FileContentAt(commit, file)
+		s.track(PhaseFetch, fetchStart)
+		if err != nil {
+			if err := s.recordError(result, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, isPointer, err := resolveLFSPointer(dir, data)
+		if isPointer && err != nil {
+			result.Files = append(result.Files, FileResult{Path: path, Commit: commit, Skipped: fmt.Sprintf("LFS content not scanned: %v", err)})
+			continue
+		}
+		contents = append(contents, content{path: path, data: data})
+	}
+
+	findings, skipped, err := s.scanContents(ctx, contents)
+	if err != nil {
+		return nil, fmt.Errorf("commit %s: %w", commit, err)
+	}
+
+	for _, c := range contents {
+		if reason, ok := skipped[c.path]; ok {
+			result.Files = append(result.Files, FileResult{Path: c.path, Commit: commit, Skipped: reason})
+			continue
+		}
+		result.Files = append(result.Files, FileResult{Path: c.path, Commit: commit, Findings: findings[c.path], RuleSet: s.config.RuleSetFor(c.path)})
+	}
+	s.markSampled(result, contents)
+	s.markContext(result, dir, added)
+	if err := s.addPathFindings(ctx, result); err != nil {
+		return nil, fmt.Errorf("commit %s: %w", commit, err)
+	}
+
+	for _, update := range submodules {
+		subResult, err := s.scanSubmodule(ctx, dir, update)
+		if err != nil {
+			return nil, err
+		}
+		result.merge(subResult)
+	}
+	return result, nil
+}
+
+// scanSubmodule scans the commits a submodule pointer update brings in. When
+// the submodule is not checked out, or does not have the new commit, the
+// update is reported as a warning instead.
+func (s *Scanner) scanSubmodule(ctx context.Context, dir string, update SubmoduleUpdate) (*Result, error) {
+	subDir := filepath.Join(dir, update.Path)
+	result := &Result{}
+
+	if !hasCommit(subDir, update.NewCommit) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"submodule %s was updated to %.8s but that commit is not checked out locally; its content was NOT scanned",
+			subDir, update.NewCommit))
+		return result, nil
+	}
+
+	commits, err := getSubmoduleCommits(subDir, update)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("submodule %s content was NOT scanned: %v", subDir, err))
+		return result, nil
+	}
+
+	for _, commit := range commits {
+		commitResult, err := s.scanCommit(ctx, subDir, commit)
+		if err != nil {
+			return nil, err
+		}
+		result.merge(commitResult)
+	}
+	return result, nil
+}
+
+// ScanFinalState scans the working-tree content of the given files, which is
+// what the remote will hold once the push lands. Files that no longer exist
+// are skipped.
+func (s *Scanner) ScanFinalState(ctx context.Context, files []string) (*Result, error) {
+	return s.scanFinalState(ctx, files, "", nil)
+}
+
+// scanFinalState is ScanFinalState for a push ending at commit tip, where
+// dirty holds the files with uncommitted changes. Under DirtyCommitted those
+// are read from tip instead of the working tree; otherwise they are marked
+// as dirty.
+func (s *Scanner) scanFinalState(ctx context.Context, files []string, tip string, dirty map[string]bool) (*Result, error) {
+	result := &Result{}
+	var contents []content
+	fromTip := make(map[string]bool)
+	for _, file := range files {
+		if !s.config.Included(file) {
+			continue
+		}
+		if s.ownFiles[file] {
+			result.Files = append(result.Files, FileResult{Path: file, Skipped: SkippedOwnFile})
+			continue
+		}
+		if dirty[file] && s.config.DirtyFiles == DirtyCommitted {
+			fetchStart := time.Now()
+			data, err := s.git.FileContentAt(tip, file)
+			s.track(PhaseFetch, fetchStart)
+			if err != nil {
+				if err := s.recordError(result, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			data, isPointer, err := resolveLFSPointer(filepath.Dir(file), data)
+			if isPointer && err != nil {
+				result.Files = append(result.Files, FileResult{Path: file, Commit: tip, Skipped: fmt.Sprintf("LFS content not scanned: %v", err)})
+				continue
+			}
+			contents = append(contents, content{path: file, data: data})
+			fromTip[file] = true
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.Size() > maxRequestBytes {
+			fileResult, err := s.scanLargeFile(ctx, file)
+			if err != nil {
+				if err := s.recordError(result, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			fileResult.Dirty = dirty[file]
+			result.Files = append(result.Files, fileResult)
+			continue
+		}
+		fetchStart := time.Now()
+		data, err := ioutil.ReadFile(file)
+		s.track(PhaseFetch, fetchStart)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err := s.recordError(result, fmt.Errorf("could not read file %s: %v", file, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, isPointer, err := resolveLFSPointer(filepath.Dir(file), data)
+		if isPointer && err != nil {
+			result.Files = append(result.Files, FileResult{Path: file, Skipped: fmt.Sprintf("LFS content not scanned: %v", err)})
+			continue
+		}
+		contents = append(contents, content{path: file, data: data})
+	}
+
+	findings, skipped, err := s.scanContents(ctx, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range contents {
+		var commit string
+		if fromTip[c.path] {
+			commit = tip
+		}
+		if reason, ok := skipped[c.path]; ok {
+			result.Files = append(result.Files, FileResult{Path: c.path, Commit: commit, Skipped: reason})
+			continue
+		}
+		result.Files = append(result.Files, FileResult{Path: c.path, Commit: commit, Findings: findings[c.path], RuleSet: s.config.RuleSetFor(c.path), Dirty: dirty[c.path] && !fromTip[c.path]})
+	}
+	s.markSampled(result, contents)
+	if err := s.addPathFindings(ctx, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ScanReader scans everything read from r as the content of a single file
+// called name, such as "<stdin>"
+func (s *Scanner) ScanReader(ctx context.Context, name string, r io.Reader) (*Result, error) {
+	// Content too large for one request is streamed rather than read whole
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxRequestBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", name, err)
+	}
+	if len(data) > maxRequestBytes {
+		findings, reason, err := s.scanStream(ctx, name, io.MultiReader(bytes.NewReader(data), r))
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Files: []FileResult{{Path: name, Findings: findings, Skipped: reason, RuleSet: s.config.RuleSetFor(name)}}}, nil
+	}
+	contents := []content{{path: name, data: data}}
+	findings, skipped, err := s.scanContents(ctx, contents)
+	if err != nil {
+		return nil, err
+	}
+	if reason, ok := skipped[name]; ok {
+		return &Result{Files: []FileResult{{Path: name, Skipped: reason}}}, nil
+	}
+	return &Result{Files: []FileResult{{Path: name, Findings: findings[name], RuleSet: s.config.RuleSetFor(name)}}}, nil
+}
+
+// ScanCommits scans each of the given commits in order, returning the
+// combined result. With Config.FailFast it stops after the first commit
+// with blocking findings. On error, the result of the commits scanned so far
+// is returned with it.
+func (s *Scanner) ScanCommits(ctx context.Context, commits []string) (*Result, error) {
+	combined := &Result{}
+	for _, commit := range commits {
+		if s.ledger != nil && s.ledger.Cleared(commit) {
+			s.ledgerSkipped++
+			continue
+		}
+		result, err := s.ScanCommit(ctx, commit)
+		if err != nil {
+			return combined, err
+		}
+		if s.ledger != nil && result.cleared() {
+			// The ledger only saves work, so failing to record is not an error
+			s.ledger.Add(commit)
+		}
+		combined.merge(result)
+		if s.config.FailFast && combined.Blocks(s.config.FailOn) {
+			break
+		}
+	}
+	return combined, nil
+}
+
+// ScanRefs scans the messages of annotated tags pointing at the given
+// commits and the notes attached to them, which are pushed alongside the
+// commits. Each is reported under its ref name, with the commit it annotates.
+func (s *Scanner) ScanRefs(ctx context.Context, commits []string) (*Result, error) {
+	result := &Result{}
+	var contents []content
+	annotates := make(map[string]string)
+	for _, commit := range commits {
+		tags, err := getAnnotatedTags(commit)
+		if err != nil {
+			if err := s.recordError(result, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, tag := range tags {
+			message, err := getTagMessage(tag)
+			if err != nil {
+				if err := s.recordError(result, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			contents = append(contents, content{path: tag, data: message})
+			annotates[tag] = commit
+		}
+		if note := getNote(commit); note != nil {
+			ref := fmt.Sprintf("refs/notes/commits:%.8s", commit)
+			contents = append(contents, content{path: ref, data: note})
+			annotates[ref] = commit
+		}
+	}
+
+	findings, skipped, err := s.scanContents(ctx, contents)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contents {
+		if reason, ok := skipped[c.path]; ok {
+			result.Files = append(result.Files, FileResult{Path: c.path, Commit: annotates[c.path], Skipped: reason})
+			continue
+		}
+		result.Files = append(result.Files, FileResult{Path: c.path, Commit: annotates[c.path], Findings: findings[c.path], RuleSet: s.config.RuleSetFor(c.path)})
+	}
+	return result, nil
+}
+
+// ScanCumulative scans only the lines added between base and HEAD, taken
+// from a single cumulative diff instead of commit by commit. Content repeated
+// across commits is inspected once, which is much faster for long histories,
+// but content added by one commit and removed by a later one is not seen even
+// though it is still pushed in history. Finding line numbers refer to the
+// new version of each file.
+func (s *Scanner) ScanCumulative(ctx context.Context, base string) (*Result, error) {
+	gitStart := time.Now()
+	files, err := getAddedLines(base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	s.track(PhaseGit, gitStart)
+
+	result := &Result{}
+	var contents []content
+	lineNumbers := make(map[string][]int)
+	for _, f := range files {
+		if !s.config.Included(f.path) {
+			continue
+		}
+		if s.ownFiles[f.path] {
+			result.Files = append(result.Files, FileResult{Path: f.path, Skipped: SkippedOwnFile})
+			continue
+		}
+		contents = append(contents, content{path: f.path, data: f.text.Bytes()})
+		lineNumbers[f.path] = f.lines
+	}
+
+	findings, skipped, err := s.scanContents(ctx, contents)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contents {
+		if reason, ok := skipped[c.path]; ok {
+			result.Files = append(result.Files, FileResult{Path: c.path, Skipped: reason})
+			continue
+		}
+		lines := lineNumbers[c.path]
+		for i, finding := range findings[c.path] {
+			// Lines counted in the added text map back to lines of the file
+			if finding.Line > 0 && finding.Line <= len(lines) {
+				findings[c.path][i].Line = lines[finding.Line-1]
+			}
+		}
+		result.Files = append(result.Files, FileResult{Path: c.path, Findings: findings[c.path], RuleSet: s.config.RuleSetFor(c.path)})
+	}
+	s.markSampled(result, contents)
+	if err := s.addPathFindings(ctx, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ScanPush scans each of the given commits, the tags and notes on them, and
+// then the final state of every file they touched, returning the combined
+// result. Files with uncommitted changes are handled as Config.DirtyFiles
+// says. With Config.FailFast the final state is not scanned once a commit
+// has blocking findings. Findings on lines neither the commits nor the final
+// state add are marked as context, see Config.BlockOnContext. On error, the
+// result scanned so far is returned with it.
+func (s *Scanner) ScanPush(ctx context.Context, commits []string) (*Result, error) {
+	combined, err := s.ScanCommits(ctx, commits)
+	if err != nil {
+		return combined, err
+	}
+	if s.config.FailFast && combined.Blocks(s.config.FailOn) {
+		return combined, nil
+	}
+
+	seen := make(map[string]bool)
+	var finalFiles []string
+	for _, f := range combined.Files {
+		// A reformat alone brings no new content into the final state, and
+		// the scanner's own files are excluded there too
+		if f.Skipped == SkippedWhitespaceOnly || f.Skipped == SkippedOwnFile {
+			continue
+		}
+		if !seen[f.Path] {
+			seen[f.Path] = true
+			finalFiles = append(finalFiles, f.Path)
+		}
+	}
+
+	// Tags, notes, uncommitted changes and added lines are only read from a
+	// real repository, see GitProvider
+	_, isRepository := s.git.(ExecGit)
+	if isRepository {
+		refs, err := s.ScanRefs(ctx, commits)
+		if err != nil {
+			return combined, err
+		}
+		combined.merge(refs)
+	}
+
+	var tip string
+	var dirty map[string]bool
+	if isRepository && len(commits) > 0 {
+		tip = commits[len(commits)-1]
+		if dirty, err = getDirtyFiles(tip); err != nil {
+			if err := s.recordError(combined, err); err != nil {
+				return combined, err
+			}
+		}
+	}
+	result, err := s.scanFinalState(ctx, finalFiles, tip, dirty)
+	if err != nil {
+		return combined, err
+	}
+	if isRepository && len(commits) > 0 {
+		added, err := pushAddedLines(commits, s.config.DirtyFiles == DirtyCommitted)
+		if err != nil {
+			if err := s.recordError(result, err); err != nil {
+				return combined, err
+			}
+		}
+		s.markContext(result, "", added)
+	}
+	combined.merge(result)
+	return combined, nil
+}
@@ -0,0 +1,390 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+	"github.com/googleapis/gax-go/v2"
+)
+
+// fakeMatch is a string fakeInspector reports as a finding wherever it
+// occurs in the inspected text
+type fakeMatch struct {
+	text       string
+	infoType   string
+	likelihood dlppb.Likelihood
+}
+
+// fakeInspector stands in for the DLP client
+type fakeInspector struct {
+	matches []fakeMatch
+
+	mu       sync.Mutex
+	requests []*dlppb.InspectContentRequest
+}
+
+// InspectContent implements Inspector
+func (f *fakeInspector) InspectContent(ctx context.Context, req *dlppb.InspectContentRequest, opts ...gax.CallOption) (*dlppb.InspectContentResponse, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	mins := make(map[string]dlppb.Likelihood)
+	for _, min := range req.GetInspectConfig().MinLikelihoodPerInfoType {
+		mins[min.InfoType.GetName()] = min.MinLikelihood
+	}
+	text := req.GetItem().GetValue()
+	result := &dlppb.InspectResult{}
+	for _, m := range f.matches {
+		if m.likelihood < mins[m.infoType] {
+			continue
+		}
+		for start := 0; ; {
+			i := strings.Index(text[start:], m.text)
+			if i < 0 {
+				break
+			}
+			start += i
+			result.Findings = append(result.Findings, &dlppb.Finding{
+				InfoType:   &dlppb.InfoType{Name: m.infoType},
+				Likelihood: m.likelihood,
+				Quote:      m.text,
+				Location: &dlppb.Location{
+					ByteRange: &dlppb.Range{Start: int64(start), End: int64(start + len(m.text))},
+				},
+			})
+			start += len(m.text)
+		}
+	}
+	if limit := int(req.GetInspectConfig().GetLimits().GetMaxFindingsPerRequest()); limit > 0 && len(result.Findings) > limit {
+		result.Findings = result.Findings[:limit]
+		result.FindingsTruncated = true
+	}
+	return &dlppb.InspectContentResponse{Result: result}, nil
+}
+
+// requestCount returns how many InspectContent calls were made
+func (f *fakeInspector) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+// testMatches are the canned findings most tests use
+var testMatches = []fakeMatch{
+	{text: "alice@example.com", infoType: "EMAIL_ADDRESS", likelihood: dlppb.Likelihood_POSSIBLE},
+	{text: "555-867-5309", infoType: "PHONE_NUMBER", likelihood: dlppb.Likelihood_VERY_LIKELY},
+}
+
+// newTestScanner returns a Scanner over a fakeInspector reporting matches,
+// under the default config changed by configure
+func newTestScanner(matches []fakeMatch, configure func(*Config)) (*Scanner, *fakeInspector) {
+	cfg := DefaultConfig()
+	cfg.Cache.Entries = 0
+	if configure != nil {
+		configure(cfg)
+	}
+	inspector := &fakeInspector{matches: matches}
+	return New(inspector, cfg), inspector
+}
+
+func TestInspect(t *testing.T) {
+	s, inspector := newTestScanner(testMatches, nil)
+	findings, err := s.Inspect(context.Background(), "contact alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].GetInfoType().GetName() != "EMAIL_ADDRESS" {
+		t.Fatalf("got %v, want one EMAIL_ADDRESS finding", findings)
+	}
+
+	var infoTypes []string
+	for _, infoType := range inspector.requests[0].GetInspectConfig().GetInfoTypes() {
+		infoTypes = append(infoTypes, infoType.GetName())
+	}
+	if got, want := strings.Join(infoTypes, ","), strings.Join(s.Config().InfoTypes, ","); got != want {
+		t.Errorf("requested info types %s, want the config's %s", got, want)
+	}
+}
+
+func TestDLPScan(t *testing.T) {
+	s, _ := newTestScanner(testMatches, nil)
+	for text, want := range map[string]bool{
+		"nothing to see here":   false,
+		"call 555-867-5309 now": true,
+	} {
+		found, err := s.DLPScan(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != want {
+			t.Errorf("DLPScan(%q) = %v, want %v", text, found, want)
+		}
+	}
+}
+
+func TestScanContentsBatching(t *testing.T) {
+	s, inspector := newTestScanner(testMatches, nil)
+	contents := []content{
+		{path: "a.txt", data: []byte("nothing here\n")},
+		{path: "b.txt", data: []byte("mail alice@example.com\n")},
+		{path: "c.txt", data: []byte("call 555-867-5309\n")},
+	}
+	findings, _, err := s.scanContents(context.Background(), contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := inspector.requestCount(); n != 1 {
+		t.Errorf("made %d DLP requests, want the small files batched into 1", n)
+	}
+	if len(findings["a.txt"]) != 0 || len(findings["b.txt"]) != 1 || len(findings["c.txt"]) != 1 {
+		t.Fatalf("got %v, want one finding each in b.txt and c.txt", findings)
+	}
+	if got := findings["b.txt"][0].InfoType; got != "EMAIL_ADDRESS" {
+		t.Errorf("b.txt finding is %s, want EMAIL_ADDRESS", got)
+	}
+}
+
+func TestExcludeInfoTypes(t *testing.T) {
+	s, _ := newTestScanner(testMatches, func(cfg *Config) {
+		cfg.ExcludeInfoTypes = []string{"PHONE_NUMBER"}
+	})
+	result, err := s.ScanReader(context.Background(), "notes.txt", strings.NewReader("555-867-5309 and 555-867-5309\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findings := result.Files[0].Findings; len(findings) != 0 {
+		t.Fatalf("got %v, want the excluded findings dropped", findings)
+	}
+	if got := s.SuppressedCounts()["PHONE_NUMBER"]; got != 2 {
+		t.Errorf("suppressed %d PHONE_NUMBER findings, want 2", got)
+	}
+}
+
+func TestLikelihoodThresholds(t *testing.T) {
+	s, inspector := newTestScanner(testMatches, func(cfg *Config) {
+		cfg.LikelihoodThresholds = map[string]string{"EMAIL_ADDRESS": "LIKELY"}
+	})
+	result, err := s.ScanReader(context.Background(), "notes.txt", strings.NewReader("alice@example.com 555-867-5309\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mins := inspector.requests[0].GetInspectConfig().MinLikelihoodPerInfoType
+	if len(mins) != 1 || mins[0].InfoType.GetName() != "EMAIL_ADDRESS" || mins[0].MinLikelihood != dlppb.Likelihood_LIKELY {
+		t.Fatalf("request thresholds = %v, want EMAIL_ADDRESS at LIKELY", mins)
+	}
+	findings := result.Files[0].Findings
+	if len(findings) != 1 || findings[0].InfoType != "PHONE_NUMBER" {
+		t.Fatalf("got %v, want only the PHONE_NUMBER finding", findings)
+	}
+}
+
+func TestInformationalFindings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LikelihoodThresholds = map[string]string{"EMAIL_ADDRESS": "LIKELY"}
+	if !cfg.Informational("EMAIL_ADDRESS", dlppb.Likelihood_POSSIBLE) {
+		t.Error("POSSIBLE email below a LIKELY threshold is not informational")
+	}
+	if cfg.Informational("EMAIL_ADDRESS", dlppb.Likelihood_VERY_LIKELY) {
+		t.Error("VERY_LIKELY email above a LIKELY threshold is informational")
+	}
+	if cfg.Informational("PHONE_NUMBER", dlppb.Likelihood_VERY_UNLIKELY) {
+		t.Error("info type without a threshold is informational")
+	}
+}
+
+func TestScanPushNothingToScan(t *testing.T) {
+	s, inspector := newTestScanner(testMatches, nil)
+	s.UseGit(fakeGit{commits: map[string]fakeCommit{
+		// An empty commit, or one that only deletes files
+		"c1": {subject: "Remove old notes"},
+	}})
+	ctx := context.Background()
+
+	for name, scan := range map[string]func() (*Result, error){
+		"ScanCommits no commits": func() (*Result, error) { return s.ScanCommits(ctx, nil) },
+		"ScanPush no commits":    func() (*Result, error) { return s.ScanPush(ctx, nil) },
+		"ScanCommits empty diff": func() (*Result, error) { return s.ScanCommits(ctx, []string{"c1"}) },
+		"ScanPush empty diff":    func() (*Result, error) { return s.ScanPush(ctx, []string{"c1"}) },
+	} {
+		result, err := scan()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(result.Files) != 0 || len(result.Errors) != 0 || result.Blocks(nil) {
+			t.Errorf("%s: files %v, errors %v, want nothing scanned and nothing blocking", name, result.Files, result.Errors)
+		}
+	}
+	if n := inspector.requestCount(); n != 0 {
+		t.Errorf("made %d DLP requests with nothing to scan", n)
+	}
+}
+
+func TestSplitLinesEmptyOutput(t *testing.T) {
+	if lines := splitLines([]byte("")); len(lines) != 0 {
+		t.Errorf("splitLines of empty git output = %q, want no lines", lines)
+	}
+	if lines := splitLines([]byte("a.txt\n")); len(lines) != 1 || lines[0] != "a.txt" {
+		t.Errorf("splitLines = %q, want [a.txt]", lines)
+	}
+}
+
+func TestScanReaderFindings(t *testing.T) {
+	s, _ := newTestScanner(testMatches, nil)
+	result, err := s.ScanReader(context.Background(), "notes.txt", strings.NewReader("first line\ncontact alice@example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := result.Files[0].Findings
+	if len(findings) != 1 {
+		t.Fatalf("got %d findings, want 1", len(findings))
+	}
+	f := findings[0]
+	if f.InfoType != "EMAIL_ADDRESS" || f.Start != 19 || f.Line != 2 || f.Column != 9 {
+		t.Errorf("got %s at %d, line %d column %d; want EMAIL_ADDRESS at 19, line 2 column 9", f.InfoType, f.Start, f.Line, f.Column)
+	}
+	if f.Fingerprint == "" {
+		t.Error("finding has no fingerprint")
+	}
+	if !result.Blocks(nil) {
+		t.Error("result does not block")
+	}
+}
+
+func TestChunkOverlapDedupe(t *testing.T) {
+	s, inspector := newTestScanner(testMatches, nil)
+
+	// 100-byte lines put the first window's end at maxRequestBytes, and the
+	// second window starts ChunkOverlapBytes earlier
+	line := strings.Repeat("x", 99) + "\n"
+	var data strings.Builder
+	for data.Len() < maxRequestBytes+50*len(line) {
+		if data.Len() == maxRequestBytes-2*len(line) {
+			data.WriteString("alice@example.com" + line[len("alice@example.com"):])
+			continue
+		}
+		data.WriteString(line)
+	}
+	start := int64(maxRequestBytes - 2*len(line))
+	if overlapStart := int64(maxRequestBytes - s.config.ChunkOverlapBytes); start < overlapStart {
+		t.Fatalf("match at %d is outside the overlap starting at %d", start, overlapStart)
+	}
+
+	findings, skipped, err := s.scanContents(context.Background(), []content{{path: "big.txt", data: []byte(data.String())}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 {
+		t.Fatalf("skipped %v", skipped)
+	}
+	if n := inspector.requestCount(); n != 2 {
+		t.Fatalf("made %d DLP requests, want one per window", n)
+	}
+	got := findings["big.txt"]
+	if len(got) != 1 {
+		t.Fatalf("got %d findings, want the two windows' findings deduplicated to 1", len(got))
+	}
+	if got[0].Start != start || got[0].Line != int(start)/len(line)+1 {
+		t.Errorf("finding at %d line %d, want %d line %d", got[0].Start, got[0].Line, start, int(start)/len(line)+1)
+	}
+}
+
+func TestAllowedCommits(t *testing.T) {
+	s, inspector := newTestScanner(testMatches, func(cfg *Config) {
+		cfg.AllowedCommits = []string{"ABCDEF1"}
+	})
+	result, err := s.ScanCommit(context.Background(), "abcdef1234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Allowlisted) != 1 || len(result.Files) != 0 {
+		t.Fatalf("got allowlisted %v and files %v, want only the commit allowlisted", result.Allowlisted, result.Files)
+	}
+	if n := inspector.requestCount(); n != 0 {
+		t.Errorf("made %d DLP requests for an allowed commit", n)
+	}
+}
+
+func TestCachedTruncation(t *testing.T) {
+	s, inspector := newTestScanner(testMatches, func(cfg *Config) {
+		cfg.Cache.Entries = 10
+		cfg.MaxFindingsPerRequest = 1
+		cfg.RescanTruncated = false
+	})
+	data := "alice@example.com 555-867-5309\n"
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := s.ScanReader(context.Background(), name, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := inspector.requestCount(); n != 1 {
+		t.Fatalf("made %d DLP requests, want the second scan served from the cache", n)
+	}
+	if got := strings.Join(s.TruncatedFiles(), ","); got != "a.txt,b.txt" {
+		t.Errorf("truncated files %s, want a.txt,b.txt", got)
+	}
+}
+
+func TestGitPathsWithSpacesAndNonASCII(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// git quotes the tab in diff headers even with core.quotePath=false
+	const spaced, tabbed = "naïve notes.txt", "tab\tname.txt"
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "base")
+	write(spaced, "first\n")
+	write(tabbed, "second\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "add files")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	added, err := getAddedLines("HEAD^", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range added {
+		paths = append(paths, f.path)
+	}
+	if len(paths) != 2 || paths[0] != spaced || paths[1] != tabbed {
+		t.Errorf("added lines in %q, want %q and %q", paths, spaced, tabbed)
+	}
+
+	write(spaced, "changed\n")
+	dirty, err := getDirtyFiles("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirty) != 1 || !dirty[spaced] {
+		t.Errorf("dirty files %v, want only %q", dirty, spaced)
+	}
+}
@@ -0,0 +1,84 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+	"github.com/googleapis/gax-go/v2"
+)
+
+// storagePollInterval is how often a running storage inspection job is polled
+const storagePollInterval = 10 * time.Second
+
+// JobClient is the part of the DLP client used for storage inspection jobs
+type JobClient interface {
+	CreateDlpJob(ctx context.Context, req *dlppb.CreateDlpJobRequest, opts ...gax.CallOption) (*dlppb.DlpJob, error)
+	GetDlpJob(ctx context.Context, req *dlppb.GetDlpJobRequest, opts ...gax.CallOption) (*dlppb.DlpJob, error)
+}
+
+// ScanStorage inspects an object (or wildcard set of objects) in Cloud Storage
+// in place with a DLP inspection job, without downloading it. Jobs only report
+// how many findings of each info type they saw, so the result carries
+// FileResult.Stats rather than individual findings.
+func (s *Scanner) ScanStorage(ctx context.Context, jobs JobClient, url string) (*Result, error) {
+	if !strings.HasPrefix(url, "gs://") {
+		return nil, fmt.Errorf("storage path %s must start with gs://", url)
+	}
+
+	req := &dlppb.CreateDlpJobRequest{
+		Parent: s.config.ParentPath(),
+		Job: &dlppb.CreateDlpJobRequest_InspectJob{InspectJob: &dlppb.InspectJobConfig{
+			StorageConfig: &dlppb.StorageConfig{Type: &dlppb.StorageConfig_CloudStorageOptions{
+				CloudStorageOptions: &dlppb.CloudStorageOptions{
+					FileSet: &dlppb.CloudStorageOptions_FileSet{Url: url},
+				},
+			}},
+			InspectConfig: s.config.InspectConfigForPath(url),
+		}},
+	}
+	job, err := jobs.CreateDlpJob(ctx, req)
+	if err != nil {
+		return nil, &DLPError{Op: fmt.Sprintf("failed to create inspection job for %s", url), Err: err}
+	}
+
+	for {
+		switch job.GetState() {
+		case dlppb.DlpJob_DONE:
+			stats := make(map[string]int64)
+			actions := make(map[string]string)
+			for _, stat := range job.GetInspectDetails().GetResult().GetInfoTypeStats() {
+				name := stat.GetInfoType().GetName()
+				if s.config.Excluded(name) {
+					s.mu.Lock()
+					s.suppressed[name] += int(stat.GetCount())
+					s.mu.Unlock()
+					continue
+				}
+				stats[name] += stat.GetCount()
+				actions[name] = s.config.ActionFor(name)
+			}
+			return &Result{Files: []FileResult{{
+				Path:        url,
+				Stats:       stats,
+				StatActions: actions,
+				RuleSet:     s.config.RuleSetFor(url),
+			}}}, nil
+		case dlppb.DlpJob_FAILED, dlppb.DlpJob_CANCELED:
+			return nil, &DLPError{Op: fmt.Sprintf("inspection job %s ended in state %s: %v", job.GetName(), job.GetState(), job.GetErrors())}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("inspection job %s did not finish: %w", job.GetName(), ctx.Err())
+		case <-time.After(storagePollInterval):
+		}
+
+		job, err = jobs.GetDlpJob(ctx, &dlppb.GetDlpJobRequest{Name: job.GetName()})
+		if err != nil {
+			return nil, &DLPError{Op: "failed to poll inspection job", Err: err}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// scanStream inspects content too large for one request as it is read, in
+// windows of at most maxRequestBytes, so memory stays bounded whatever the
+// size. Windows end at a newline where there is one and overlap by
+// Config.ChunkOverlapBytes, rounded back to a line start, so line and column
+// numbers can be kept. Streamed content skips the cache and the flattening
+// of JSON and YAML, and is chunked even under OversizedSample since its size
+// is not known up front. It returns the findings, or the reason the content
+// was skipped.
+func (s *Scanner) scanStream(ctx context.Context, path string, r io.Reader) ([]Finding, string, error) {
+	if s.config.OversizedFiles == OversizedSkip {
+		return nil, SkippedOversized, nil
+	}
+	inspectConfig := s.config.InspectConfigForPath(path)
+
+	var findings []Finding
+	buf := make([]byte, 0, maxRequestBytes)
+	var origin int64 // offset of buf[0] in the content
+	line := 1        // line number of buf[0]
+	for {
+		fetchStart := time.Now()
+		n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+		s.track(PhaseFetch, fetchStart)
+		buf = buf[:len(buf)+n]
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return nil, "", fmt.Errorf("could not read %s: %v", path, err)
+		}
+		if origin == 0 {
+			if _, ok := documentBytesType(path, buf); ok {
+				// Documents must be inspected whole
+				return nil, SkippedOversized, nil
+			}
+		}
+
+		end := len(buf)
+		if !eof {
+			if nl := bytes.LastIndexByte(buf, '\n'); nl > 0 {
+				end = nl + 1
+			}
+		}
+		window := buf[:end]
+
+		local, reason, err := s.inspectWindow(ctx, path, inspectConfig, window)
+		if err != nil || reason != "" {
+			return nil, reason, err
+		}
+		for _, f := range local {
+			setFingerprint(&f, path, window, true)
+			l, column := lineColumn(window, f.Start)
+			f.Line, f.Column = line+l-1, column
+			f.Start += origin
+			f.End += origin
+			findings = append(findings, f)
+		}
+
+		if eof {
+			break
+		}
+		next := end - s.config.ChunkOverlapBytes
+		if next <= 0 {
+			next = end
+		} else if nl := bytes.LastIndexByte(buf[:next], '\n'); nl >= 0 {
+			next = nl + 1
+		}
+		line += bytes.Count(buf[:next], []byte{'\n'})
+		origin += int64(next)
+		buf = buf[:copy(buf, buf[next:])]
+	}
+
+	findings = s.excludeFindings(dedupeFindings(findings))
+	for i := range findings {
+		s.applyPolicy(&findings[i])
+	}
+	return findings, "", nil
+}
+
+// scanLargeFile scans a working-tree file too large for one request with
+// scanStream, or with sampleFile under OversizedSample
+func (s *Scanner) scanLargeFile(ctx context.Context, path string) (FileResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileResult{}, fmt.Errorf("could not read file %s: %v", path, err)
+	}
+	defer f.Close()
+	var findings []Finding
+	var reason string
+	sampled := s.config.OversizedFiles == OversizedSample
+	if sampled {
+		var info os.FileInfo
+		if info, err = f.Stat(); err == nil {
+			findings, reason, err = s.sampleFile(ctx, path, f, info.Size())
+		}
+	} else {
+		findings, reason, err = s.scanStream(ctx, path, f)
+	}
+	if err != nil {
+		return FileResult{}, err
+	}
+	if reason != "" {
+		return FileResult{Path: path, Skipped: reason}, nil
+	}
+	return FileResult{Path: path, Findings: findings, RuleSet: s.config.RuleSetFor(path), Sampled: sampled}, nil
+}
@@ -0,0 +1,227 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// fieldSpan maps one line of a flattened structured file back to its source
+type fieldSpan struct {
+	field string
+	// lineStart, valueStart and lineEnd are offsets in the flattened text
+	lineStart  int64
+	valueStart int64
+	lineEnd    int64
+	// sourceStart is the offset in the original content where the value begins
+	sourceStart int64
+}
+
+// flattened is a structured file rewritten as one "key.path: value" line per
+// scalar, so DLP sees each value next to the name of the field holding it
+type flattened struct {
+	text  bytes.Buffer
+	spans []fieldSpan
+}
+
+// add appends a line for value, found at sourceStart in the original content
+func (f *flattened) add(field, value string, sourceStart int64) {
+	span := fieldSpan{field: field, lineStart: int64(f.text.Len()), sourceStart: sourceStart}
+	if field != "" {
+		f.text.WriteString(field)
+		f.text.WriteString(": ")
+	}
+	span.valueStart = int64(f.text.Len())
+	f.text.WriteString(value)
+	span.lineEnd = int64(f.text.Len())
+	f.text.WriteByte('\n')
+	f.spans = append(f.spans, span)
+}
+
+// locate rewrites a finding's offsets from the flattened text to the original
+// content and records the field it was found in. Offsets are exact for plain
+// values and approximate for JSON strings containing escape sequences.
+func (f *flattened) locate(finding *Finding) {
+	for _, span := range f.spans {
+		if finding.Start < span.lineStart || finding.Start > span.lineEnd {
+			continue
+		}
+		finding.Field = span.field
+		length := finding.End - finding.Start
+		if finding.Start >= span.valueStart {
+			finding.Start = span.sourceStart + finding.Start - span.valueStart
+		} else {
+			// The match is in the key name itself
+			finding.Start = span.sourceStart
+		}
+		finding.End = finding.Start + length
+		return
+	}
+}
+
+// flattenStructured flattens JSON and YAML files by extension. The boolean is
+// false for other files and for content that does not parse.
+func flattenStructured(path string, data []byte) (*flattened, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return flattenJSON(data)
+	case ".yaml", ".yml":
+		return flattenYAML(data), true
+	}
+	return nil, false
+}
+
+// jsonFrame tracks the position inside one JSON object or array
+type jsonFrame struct {
+	object    bool
+	key       string
+	index     int
+	expectKey bool
+}
+
+// advance moves a frame past the value that filled its current slot
+func (f *jsonFrame) advance() {
+	if f.object {
+		f.expectKey = true
+	} else {
+		f.index++
+	}
+}
+
+// jsonPath renders the key path of the slot currently being filled
+func jsonPath(stack []*jsonFrame) string {
+	var b strings.Builder
+	for _, frame := range stack {
+		if frame.object {
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(frame.key)
+		} else {
+			fmt.Fprintf(&b, "[%d]", frame.index)
+		}
+	}
+	return b.String()
+}
+
+// flattenJSON walks a JSON document token by token, recording each scalar
+// with its key path and source offset
+func flattenJSON(data []byte) (*flattened, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	out := &flattened{}
+	var stack []*jsonFrame
+
+	for {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				stack = append(stack, &jsonFrame{object: delim == '{', expectKey: delim == '{'})
+			case '}', ']':
+				stack = stack[:len(stack)-1]
+				if len(stack) > 0 {
+					stack[len(stack)-1].advance()
+				}
+			}
+			continue
+		}
+
+		if top != nil && top.object && top.expectKey {
+			top.key, _ = tok.(string)
+			top.expectKey = false
+			continue
+		}
+
+		// The decoder skips the ':' or ',' before a value without reporting it
+		start := before
+		for start < int64(len(data)) && strings.IndexByte(" \t\r\n:,", data[start]) >= 0 {
+			start++
+		}
+		value := fmt.Sprint(tok)
+		if _, ok := tok.(string); ok {
+			start++ // skip the opening quote
+		}
+		out.add(jsonPath(stack), value, start)
+		if top != nil {
+			top.advance()
+		}
+	}
+	return out, true
+}
+
+// yamlKey is one level of the key path while walking YAML lines
+type yamlKey struct {
+	indent int
+	key    string
+}
+
+// flattenYAML rewrites YAML line by line, prefixing each value with the path
+// of mapping keys above it. Lines it does not understand, including comments,
+// are kept as they are so no content goes unscanned.
+func flattenYAML(data []byte) *flattened {
+	out := &flattened{}
+	var stack []yamlKey
+	offset := int64(0)
+
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		lineStart := offset
+		offset += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		valueOffset := lineStart + int64(indent)
+
+		if strings.HasPrefix(trimmed, "#") {
+			out.add("", trimmed, valueOffset)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			trimmed = trimmed[2:]
+			indent += 2
+			valueOffset += 2
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		key, value, isPair := strings.Cut(trimmed, ":")
+		if isPair && (value == "" || value[0] == ' ') && key != "" && !strings.ContainsAny(key[:1], "{[\"'") {
+			stack = append(stack, yamlKey{indent: indent, key: strings.TrimSpace(key)})
+			value = strings.TrimLeft(value, " ")
+			if value == "" {
+				continue
+			}
+			valueOffset += int64(len(trimmed) - len(value))
+			trimmed = value
+		}
+
+		var path []string
+		for _, k := range stack {
+			path = append(path, k.key)
+		}
+		out.add(strings.Join(path, "."), trimmed, valueOffset)
+	}
+	return out
+}
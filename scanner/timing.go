@@ -0,0 +1,34 @@
+package scanner
+
+import "time"
+
+// Scan phases timed by the Scanner, see Timings
+const (
+	// PhaseGit is listing commits' changed files and diffs
+	PhaseGit = "git enumeration"
+	// PhaseFetch is reading file content from commits and the working tree
+	PhaseFetch = "content fetch"
+	// PhaseDLP is waiting on DLP inspection requests
+	PhaseDLP = "DLP requests"
+)
+
+// track adds the time since start to phase
+func (s *Scanner) track(phase string, start time.Time) {
+	elapsed := time.Since(start)
+	s.mu.Lock()
+	s.timings[phase] += elapsed
+	s.mu.Unlock()
+}
+
+// Timings returns the time spent so far in each phase. Requests run
+// concurrently, so PhaseDLP is their total duration and can exceed the wall
+// clock time of the scan.
+func (s *Scanner) Timings() map[string]time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timings := make(map[string]time.Duration, len(s.timings))
+	for phase, d := range s.timings {
+		timings[phase] = d
+	}
+	return timings
+}
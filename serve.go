@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"dlp-test/scanner"
+)
+
+// serveAddrEnvVar names the environment variable that can set the listen address
+const serveAddrEnvVar = "DLP_SERVE_ADDR"
+
+// defaultServeAddr is the listen address used when none is configured
+const defaultServeAddr = ":8080"
+
+// maxInspectBodyBytes bounds the content accepted by POST /inspect
+const maxInspectBodyBytes = 10 << 20
+
+// defaultSkippedContentTypes are the binary media types POST /inspect does
+// not scan; images and documents are still inspected, by OCR and parsing
+var defaultSkippedContentTypes = []string{"application/octet-stream", "application/zip", "application/gzip", "audio/*", "video/*"}
+
+// contentTypeMatches reports whether mediaType matches any of patterns,
+// which are media types or "type/*" wildcards
+func contentTypeMatches(mediaType string, patterns []string) bool {
+	for _, p := range patterns {
+		if p == mediaType || strings.HasSuffix(p, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanBody scans a request body according to its Content-Type: JSON is
+// scanned field by field, form values are scanned decoded, each part of a
+// multipart form is scanned as a file of its own and anything else as one
+// file. Bodies of a type in skipTypes are reported as skipped.
+func scanBody(ctx context.Context, s *scanner.Scanner, name, contentType string, data []byte, skipTypes []string) (*scanner.Result, error) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case contentTypeMatches(mediaType, skipTypes):
+		return &scanner.Result{Files: []scanner.FileResult{{Path: name, Skipped: "binary content type " + mediaType}}}, nil
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		// The extension has the scanner report the key path of each finding
+		if filepath.Ext(name) != ".json" {
+			name += ".json"
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse form: %v", err)
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var decoded bytes.Buffer
+		for _, key := range keys {
+			for _, v := range values[key] {
+				fmt.Fprintf(&decoded, "%s=%s\n", key, v)
+			}
+		}
+		data = decoded.Bytes()
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return scanMultipart(ctx, s, name, multipart.NewReader(bytes.NewReader(data), params["boundary"]), skipTypes)
+	}
+	return s.ScanReader(ctx, name, bytes.NewReader(data))
+}
+
+// scanMultipart scans each part of a multipart body with scanBody, as a file
+// named after the body and the part's file or form field name
+func scanMultipart(ctx context.Context, s *scanner.Scanner, name string, reader *multipart.Reader, skipTypes []string) (*scanner.Result, error) {
+	combined := &scanner.Result{}
+	for i := 1; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return combined, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read multipart body: %v", err)
+		}
+		partName := part.FileName()
+		if partName == "" {
+			partName = part.FormName()
+		}
+		if partName == "" {
+			partName = strconv.Itoa(i)
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("could not read part %s: %v", partName, err)
+		}
+		result, err := scanBody(ctx, s, name+"/"+partName, part.Header.Get("Content-Type"), data, skipTypes)
+		if err != nil {
+			return nil, err
+		}
+		combined.Files = append(combined.Files, result.Files...)
+		combined.Warnings = append(combined.Warnings, result.Warnings...)
+		combined.Errors = append(combined.Errors, result.Errors...)
+	}
+}
+
+// blockedFinding is a finding in the response to a blocked request, with
+// the file it was found in
+type blockedFinding struct {
+	Path string `json:"path"`
+	scanner.ReportFinding
+}
+
+// blockedResponse is the body of the 422 response to a request the policy
+// blocks. Like the report, it never carries the matched text.
+type blockedResponse struct {
+	Blocked  bool             `json:"blocked"`
+	Findings []blockedFinding `json:"findings"`
+}
+
+// newBlockedResponse lists the findings of report in a blockedResponse
+func newBlockedResponse(report *scanner.Report) blockedResponse {
+	response := blockedResponse{Blocked: true, Findings: []blockedFinding{}}
+	for _, f := range report.Files {
+		for _, finding := range f.Findings {
+			response.Findings = append(response.Findings, blockedFinding{Path: f.Path, ReportFinding: finding})
+		}
+	}
+	return response
+}
+
+// inspectHandler serves POST /inspect: it scans the request body, named by
+// the optional "name" query parameter so path rules and document types
+// apply, routed by its Content-Type as scanBody describes, and answers with
+// the JSON report of the scan, or with 422 and a blockedResponse when the
+// policy blocks the content. Each request gets a Scanner of its own, so the
+// retry budget and the scan's counters start afresh.
+func inspectHandler(client scanner.Inspector, cfg *scanner.Config, skipTypes []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("use POST"))
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = "<request>"
+		}
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxInspectBodyBytes))
+		if err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("could not read content: %v", err))
+			return
+		}
+		result, err := scanBody(r.Context(), scanner.New(client, cfg), name, r.Header.Get("Content-Type"), data, skipTypes)
+		var dlpErr *scanner.DLPError
+		if err != nil && !errors.As(err, &dlpErr) {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusBadGateway, err)
+			return
+		}
+		blocked := result.Blocks(cfg.FailOn)
+		report := scanner.NewReport("inspect", "", result, blocked, cfg.RiskScore(result))
+		if blocked {
+			writeJSON(w, http.StatusUnprocessableEntity, newBlockedResponse(report))
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes err as a JSON {"error": "..."} response
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// envOr returns the value of the environment variable name, or fallback when unset or empty
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// runServe runs an HTTP inspection service for other tools, scanning content
+// posted to /inspect under the scan config without touching git
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	credentialsFile := fs.String("credentials", os.Getenv(credentialsEnvVar), "path to a service account JSON key file (defaults to $"+credentialsEnvVar+")")
+	configFile := fs.String("config", "", "path to a JSON scan config (defaults to "+scanner.DefaultConfigFile+" when present)")
+	addr := fs.String("addr", envOr(serveAddrEnvVar, defaultServeAddr), "host:port to listen on, port 0 for an ephemeral port (defaults to $"+serveAddrEnvVar+" or "+defaultServeAddr+")")
+	var skipTypes listFlag
+	fs.Var(&skipTypes, "skip-content-types", "media types, or type/* wildcards, of request bodies not to scan, comma-separated or repeated (defaults to "+strings.Join(defaultSkippedContentTypes, ",")+")")
+	fs.Parse(args)
+	if len(skipTypes) == 0 {
+		skipTypes = defaultSkippedContentTypes
+	}
+
+	configPath := *configFile
+	if configPath == "" {
+		configPath = scanner.DefaultConfigFile
+	}
+	cfg, err := scanner.LoadConfig(configPath, *configFile != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	clientOpts := scanner.DefaultClientOptions()
+	clientOpts.CredentialsFile = *credentialsFile
+	client, err := scanner.NewClient(ctx, clientOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating DLP client: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// Listening first reports a busy port clearly and, for port 0, the
+	// port that was chosen
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			fmt.Fprintf(os.Stderr, "Error: %s is already in use; pick another with -addr or $%s.\n", *addr, serveAddrEnvVar)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error listening on %s: %v\n", *addr, err)
+		}
+		os.Exit(1)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/inspect", inspectHandler(client, cfg, skipTypes))
+	fmt.Printf("Serving DLP inspection on %s.\n", listener.Addr())
+	if err := http.Serve(listener, mux); err != nil {
+		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+		os.Exit(1)
+	}
+}
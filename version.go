@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, injected at build time with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.gitCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	gitCommit = "unknown"
+	buildDate = "unknown"
+)
+
+// dlpModule is the module path of the DLP client library
+const dlpModule = "cloud.google.com/go/dlp"
+
+// dlpLibraryVersion returns the version of the DLP client library compiled in
+func dlpLibraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == dlpModule {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// printVersion prints the build information of this binary
+func printVersion() {
+	fmt.Printf("dlp-scan %s\n", version)
+	fmt.Printf("  commit:      %s\n", gitCommit)
+	fmt.Printf("  built:       %s\n", buildDate)
+	fmt.Printf("  go:          %s\n", runtime.Version())
+	fmt.Printf("  dlp library: %s %s\n", dlpModule, dlpLibraryVersion())
+}